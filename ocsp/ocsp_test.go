@@ -0,0 +1,433 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rongzer/gm/sm2"
+	"github.com/rongzer/gm/x509"
+)
+
+// The root and leaf of the x509 package tests, issued by OpenSSL 3.0.
+const (
+	opensslRootPEM = `-----BEGIN CERTIFICATE-----
+MIIBwTCCAWegAwIBAgIBATAKBggqgRzPVQGDdTBHMQswCQYDVQQGEwJDTjEVMBMG
+A1UECgwMUm9uZ3plciBUZXN0MSEwHwYDVQQDDBhSb25nemVyIFRlc3QgU00yIFJv
+b3QgQ0EwIBcNMjYxMDE4MTE0MTU1WhgPMjEyNjA5MjQxMTQxNTVaMEcxCzAJBgNV
+BAYTAkNOMRUwEwYDVQQKDAxSb25nemVyIFRlc3QxITAfBgNVBAMMGFJvbmd6ZXIg
+VGVzdCBTTTIgUm9vdCBDQTBZMBMGByqGSM49AgEGCCqBHM9VAYItA0IABFSD7s0s
+mu3bJFk+mHFGAncA7OCCyPxaojadGsU8F3FwZHR764j6lzutsGdDC0BN2X6YFpYl
+KsZyP91sPV9TdV2jQjBAMA8GA1UdEwEB/wQFMAMBAf8wDgYDVR0PAQH/BAQDAgEG
+MB0GA1UdDgQWBBSiOtnpwcxVNb2o6YyqXYuwY6lLujAKBggqgRzPVQGDdQNIADBF
+AiEAgXZY7cmtw8QYc0GelnakcztqZqDK8pd5zXsBbcMuBSQCIFCyR378tGPg4wx+
+ENA3Xd0KMLKAAQgo0eq9LHrlTs9k
+-----END CERTIFICATE-----
+`
+	opensslLeafPEM = `-----BEGIN CERTIFICATE-----
+MIIC/jCCAqWgAwIBAgICEjQwCgYIKoEcz1UBg3UwRzELMAkGA1UEBhMCQ04xFTAT
+BgNVBAoMDFJvbmd6ZXIgVGVzdDEhMB8GA1UEAwwYUm9uZ3plciBUZXN0IFNNMiBS
+b290IENBMCAXDTI2MTAxODExNDE1NVoYDzIxMjYwOTI0MTE0MTU1WjA9MQswCQYD
+VQQGEwJDTjEVMBMGA1UECgwMUm9uZ3plciBUZXN0MRcwFQYDVQQDDA5nbS5leGFt
+cGxlLmNvbTBZMBMGByqGSM49AgEGCCqBHM9VAYItA0IABOZ2BRmtbnjAv7hvyP6z
+gsBssswPul7tQbXnBARBFJud1zkIz45t59kbTmeZBpWhMGp52UjstH+OJH/Lj+BF
+/XajggGHMIIBgzAMBgNVHRMBAf8EAjAAMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUE
+FjAUBggrBgEFBQcDAQYIKwYBBQUHAwIwXwYDVR0RBFgwVoIOZ20uZXhhbXBsZS5j
+b22CECouZ20uZXhhbXBsZS5jb22HBH8AAAGBEWFkbWluQGV4YW1wbGUuY29thhlo
+dHRwczovL2dtLmV4YW1wbGUuY29tL2lkMB0GA1UdDgQWBBSRd+fwTehwOkQaY9PI
+0TGwUSZ2YzAfBgNVHSMEGDAWgBSiOtnpwcxVNb2o6YyqXYuwY6lLujAwBgNVHR8E
+KTAnMCWgI6Ahhh9odHRwOi8vY3JsLmV4YW1wbGUuY29tL3Jvb3QuY3JsMF8GCCsG
+AQUFBwEBBFMwUTAjBggrBgEFBQcwAYYXaHR0cDovL29jc3AuZXhhbXBsZS5jb20w
+KgYIKwYBBQUHMAKGHmh0dHA6Ly9jYS5leGFtcGxlLmNvbS9yb290LmNlcjAQBgNV
+HSAECTAHMAUGAyoDBDAKBggqgRzPVQGDdQNHADBEAiBhCreTVvxcO5dGUpiob95D
+AZVOFRdaWyBeb0blDb1MQwIgIIBoYEWC61lezayC6+H53Zrz2TbrtZ+GK1Yl1Pfk
+Pio=
+-----END CERTIFICATE-----
+`
+)
+
+// An OCSP request for opensslLeafPEM created by
+// "openssl ocsp -sm3 -issuer root.pem -cert leaf.pem -no_nonce".
+const opensslRequestHex = `305e305c305a30583056300c06082a811ccf55018311050004201e88965006c3
+b2eea47a6a7100239806dc61ad709a5669d55f59d31cbb2b9c0b0420865274fc
+7c21f7f294ace15d0be9dbbfee9b9d526707ec0c01ca95eb895878ec02021234`
+
+// The response of "openssl ocsp -index ... -rsigner root.pem -rmd sm3
+// -rsigopt distid:1234567812345678" to opensslRequestHex, reporting the
+// leaf revoked for key compromise and embedding the root.
+const opensslResponseBase64 = `MIIDOgoBAKCCAzMwggMvBgkrBgEFBQcwAQEEggMgMIIDHDCB9qFJMEcxCzAJBgNVBAYTAkNOMRUw
+EwYDVQQKDAxSb25nemVyIFRlc3QxITAfBgNVBAMMGFJvbmd6ZXIgVGVzdCBTTTIgUm9vdCBDQRgP
+MjAyNjEwMTgxMjAwMzBaMIGXMIGUMFYwDAYIKoEcz1UBgxEFAAQgHoiWUAbDsu6kempxACOYBtxh
+rXCaVmnVX1nTHLsrnAsEIIZSdPx8IffylKzhXQvp27/um51SZwfsDAHKleuJWHjsAgISNKEWGA8y
+MDI2MTAxODExNTU0OVqgAwoBARgPMjAyNjEwMTgxMjAwMzBaoBEYDzIxMjYwOTI0MTIwMDMwWjAK
+BggqgRzPVQGDdQNIADBFAiEAuSZRzrUqyLWpY1hUlm2f9sc7ecgOWR0ldJ8m9sgh+FUCICMb5PKa
+EcdiOiOHJsITVP8U1cMxsXTAsFSHMxRRNKEZoIIByTCCAcUwggHBMIIBZ6ADAgECAgEBMAoGCCqB
+HM9VAYN1MEcxCzAJBgNVBAYTAkNOMRUwEwYDVQQKDAxSb25nemVyIFRlc3QxITAfBgNVBAMMGFJv
+bmd6ZXIgVGVzdCBTTTIgUm9vdCBDQTAgFw0yNjEwMTgxMTQxNTVaGA8yMTI2MDkyNDExNDE1NVow
+RzELMAkGA1UEBhMCQ04xFTATBgNVBAoMDFJvbmd6ZXIgVGVzdDEhMB8GA1UEAwwYUm9uZ3plciBU
+ZXN0IFNNMiBSb290IENBMFkwEwYHKoZIzj0CAQYIKoEcz1UBgi0DQgAEVIPuzSya7dskWT6YcUYC
+dwDs4ILI/FqiNp0axTwXcXBkdHvriPqXO62wZ0MLQE3ZfpgWliUqxnI/3Ww9X1N1XaNCMEAwDwYD
+VR0TAQH/BAUwAwEB/zAOBgNVHQ8BAf8EBAMCAQYwHQYDVR0OBBYEFKI62enBzFU1vajpjKpdi7Bj
+qUu6MAoGCCqBHM9VAYN1A0gAMEUCIQCBdljtya3DxBhzQZ6WdqRzO2pmoMryl3nNewFtwy4FJAIg
+ULJHfvy0Y+DjDH4Q0Ddd3QowsoABCCjR6r0seuVOz2Q=
+`
+
+func mustParseCertificate(t *testing.T, s string) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		t.Fatal("failed to decode PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func mustDecode(t *testing.T, s string, decode func(string) ([]byte, error)) []byte {
+	t.Helper()
+	der, err := decode(strings.Replace(s, "\n", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestOpenSSLRequest(t *testing.T) {
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+	der := mustDecode(t, opensslRequestHex, hex.DecodeString)
+
+	req, err := ParseRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.HashAlgorithm != 0 {
+		t.Errorf("HashAlgorithm = %v, want SM3", req.HashAlgorithm)
+	}
+	if req.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Errorf("SerialNumber = %v, want %v", req.SerialNumber, leaf.SerialNumber)
+	}
+
+	created, err := CreateRequest(leaf, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(created, der) {
+		t.Errorf("CreateRequest = %x, want %x", created, der)
+	}
+}
+
+func TestOpenSSLResponse(t *testing.T) {
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+	der := mustDecode(t, opensslResponseBase64, base64.StdEncoding.DecodeString)
+
+	resp, err := ParseResponseForCert(der, leaf, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != Revoked || resp.RevocationReason != KeyCompromise {
+		t.Errorf("Status = %d, RevocationReason = %d, want Revoked, KeyCompromise", resp.Status, resp.RevocationReason)
+	}
+	if resp.SignatureAlgorithm != x509.SM2WithSM3 {
+		t.Errorf("SignatureAlgorithm = %v, want SM2WithSM3", resp.SignatureAlgorithm)
+	}
+	if resp.IssuerHash != 0 {
+		t.Errorf("IssuerHash = %v, want SM3", resp.IssuerHash)
+	}
+	if resp.Certificate == nil || !resp.Certificate.Equal(root) {
+		t.Error("embedded certificate is not the root")
+	}
+	if !bytes.Equal(resp.RawResponderName, root.RawSubject) {
+		t.Error("RawResponderName is not the subject of the root")
+	}
+
+	if _, err := ParseResponse(der, leaf); err == nil {
+		t.Error("ParseResponse accepted a response whose responder was not issued by issuer")
+	}
+	if _, err := ParseResponseForCert(der, root, root); err == nil {
+		t.Error("ParseResponseForCert found a response for another serial number")
+	}
+}
+
+// newCA returns a self-signed SM2 CA with its key.
+func newCA(t *testing.T, name string) (*x509.Certificate, *sm2.PrivateKey) {
+	t.Helper()
+	key, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// newResponder returns an SM2 responder certificate issued by ca with the
+// given extended key usages, and its key.
+func newResponder(t *testing.T, ca *x509.Certificate, caKey crypto.Signer, usages ...x509.ExtKeyUsage) (*x509.Certificate, *sm2.PrivateKey) {
+	t.Helper()
+	key, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+	der, err := x509.CreateCertificate(template, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestCreateResponse(t *testing.T) {
+	ca, caKey := newCA(t, "ca")
+	leaf, _ := newResponder(t, ca, caKey)
+	leaf.SerialNumber = big.NewInt(0x1234)
+	responder, responderKey := newResponder(t, ca, caKey, x509.ExtKeyUsageOCSPSigning)
+
+	thisUpdate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := Response{
+		Status:           Revoked,
+		SerialNumber:     leaf.SerialNumber,
+		ThisUpdate:       thisUpdate,
+		NextUpdate:       thisUpdate.Add(24 * time.Hour),
+		RevokedAt:        thisUpdate.Add(-time.Hour),
+		RevocationReason: Superseded,
+	}
+
+	for _, tc := range []struct {
+		name       string
+		responder  *x509.Certificate
+		key        crypto.Signer
+		embed      bool
+		issuerHash crypto.Hash
+	}{
+		{"issuer", ca, caKey, false, 0},
+		{"issuer as ecdsa.PrivateKey", ca, caKey.PrivateKey, false, 0},
+		{"delegated", responder, responderKey, true, 0},
+		{"delegated with SHA-256", responder, responderKey, true, crypto.SHA256},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			template := template
+			template.IssuerHash = tc.issuerHash
+			if tc.embed {
+				template.Certificate = tc.responder
+			}
+			der, err := CreateResponse(ca, tc.responder, template, tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := ParseResponseForCert(der, leaf, ca)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != Revoked || resp.RevocationReason != Superseded ||
+				!resp.RevokedAt.Equal(template.RevokedAt) ||
+				!resp.ThisUpdate.Equal(template.ThisUpdate) ||
+				!resp.NextUpdate.Equal(template.NextUpdate) ||
+				resp.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+				t.Errorf("unexpected response %+v", resp)
+			}
+			if resp.IssuerHash != tc.issuerHash {
+				t.Errorf("IssuerHash = %v, want %v", resp.IssuerHash, tc.issuerHash)
+			}
+			if resp.SignatureAlgorithm != x509.SM2WithSM3 {
+				t.Errorf("SignatureAlgorithm = %v, want SM2WithSM3", resp.SignatureAlgorithm)
+			}
+			if !bytes.Equal(resp.RawResponderName, tc.responder.RawSubject) {
+				t.Error("RawResponderName is not the subject of the responder")
+			}
+			if !tc.embed {
+				if err := resp.CheckSignatureFrom(ca); err != nil {
+					t.Error(err)
+				}
+			}
+
+			other, _ := newCA(t, "ca")
+			if _, err := ParseResponseForCert(der, leaf, other); err == nil {
+				t.Error("response accepted with an unrelated issuer")
+			}
+		})
+	}
+}
+
+func TestCreateResponseStatus(t *testing.T) {
+	ca, caKey := newCA(t, "ca")
+	for _, status := range []int{Good, Unknown} {
+		der, err := CreateResponse(ca, ca, Response{
+			Status:       status,
+			SerialNumber: big.NewInt(42),
+			ThisUpdate:   time.Now(),
+		}, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ParseResponse(der, ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != status || !resp.NextUpdate.IsZero() {
+			t.Errorf("Status = %d, NextUpdate = %v, want %d and no NextUpdate", resp.Status, resp.NextUpdate, status)
+		}
+	}
+}
+
+func TestResponderNotAuthorized(t *testing.T) {
+	ca, caKey := newCA(t, "ca")
+	responder, responderKey := newResponder(t, ca, caKey, x509.ExtKeyUsageServerAuth)
+
+	der, err := CreateResponse(ca, responder, Response{
+		Status:       Good,
+		SerialNumber: big.NewInt(42),
+		ThisUpdate:   time.Now(),
+		Certificate:  responder,
+	}, responderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(der, ca); err == nil {
+		t.Error("response accepted from a responder without the OCSPSigning usage")
+	}
+
+	// Without an embedded certificate the response must be signed by the
+	// issuer itself.
+	der, err = CreateResponse(ca, responder, Response{
+		Status:       Good,
+		SerialNumber: big.NewInt(42),
+		ThisUpdate:   time.Now(),
+	}, responderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(der, ca); err == nil {
+		t.Error("response accepted without a signature from the issuer")
+	}
+}
+
+func TestCreateResponseErrors(t *testing.T) {
+	ca, caKey := newCA(t, "ca")
+	template := Response{Status: Good, SerialNumber: big.NewInt(42), ThisUpdate: time.Now()}
+
+	template.IssuerHash = crypto.MD5
+	if _, err := CreateResponse(ca, ca, template, caKey); err == nil {
+		t.Error("CreateResponse accepted MD5 as the issuer hash")
+	}
+
+	template.IssuerHash = 0
+	template.SignatureAlgorithm = x509.SHA256WithRSA
+	if _, err := CreateResponse(ca, ca, template, caKey); err == nil {
+		t.Error("CreateResponse accepted an RSA signature algorithm for an SM2 key")
+	}
+
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SignatureAlgorithm = 0
+	der, err := CreateResponse(ca, ca, template, p256Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ParseResponse(der, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SignatureAlgorithm != x509.ECDSAWithSHA256 {
+		t.Errorf("SignatureAlgorithm = %v, want ECDSAWithSHA256", resp.SignatureAlgorithm)
+	}
+	if err := resp.CheckSignatureFrom(ca); err == nil {
+		t.Error("CheckSignatureFrom accepted a signature from another key")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	for _, tc := range []struct {
+		der    []byte
+		status ResponseStatus
+	}{
+		{MalformedRequestErrorResponse, Malformed},
+		{InternalErrorErrorResponse, InternalError},
+		{TryLaterErrorResponse, TryLater},
+		{SigRequredErrorResponse, SignatureRequired},
+		{UnauthorizedErrorResponse, Unauthorized},
+	} {
+		_, err := ParseResponse(tc.der, nil)
+		if respErr, ok := err.(ResponseError); !ok || respErr.Status != tc.status {
+			t.Errorf("ParseResponse(%x) = %v, want ResponseError %v", tc.der, err, tc.status)
+		}
+	}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	ca, _ := newCA(t, "ca")
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(7)}
+
+	for _, h := range []crypto.Hash{0, crypto.SHA1, crypto.SHA256} {
+		der, err := CreateRequest(leaf, ca, &RequestOptions{Hash: h})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := ParseRequest(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.HashAlgorithm != h || req.SerialNumber.Cmp(leaf.SerialNumber) != 0 || len(req.IssuerNameHash) != len(req.IssuerKeyHash) {
+			t.Errorf("unexpected request %+v for %v", req, h)
+		}
+	}
+
+	if _, err := CreateRequest(leaf, ca, &RequestOptions{Hash: crypto.MD5}); err == nil {
+		t.Error("CreateRequest accepted MD5")
+	}
+	if _, err := ParseRequest([]byte{0x30, 0x00}); err == nil {
+		t.Error("ParseRequest accepted an empty request")
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/rongzer/gm/sm2"
+	"github.com/rongzer/gm/sm4"
+	"github.com/rongzer/gm/x509"
+)
+
+var (
+	// The SM2 encryption of GM/T 0010, whose output is the SM2Cipher
+	// structure of GM/T 0009.
+	oidKeyEncryptionSM2 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301, 3}
+
+	oidEncryptionSM4CBC = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 104, 2}
+	oidEncryptionSM4GCM = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 104, 8}
+)
+
+// ErrNotEnvelopedData is returned when a decrypt operation is attempted on
+// a message that is not enveloped data.
+var ErrNotEnvelopedData = errors.New("pkcs7: content is not enveloped data")
+
+// ErrNotRecipient is returned by Decrypt when the message is not encrypted
+// for the given certificate.
+var ErrNotRecipient = errors.New("pkcs7: no recipient for the certificate")
+
+// EncryptionAlgorithm is the algorithm that encrypts the content of an
+// EnvelopedData message.
+type EncryptionAlgorithm int
+
+const (
+	// EncryptionAlgorithmSM4CBC is SM4 in CBC mode with PKCS #7 padding.
+	EncryptionAlgorithmSM4CBC EncryptionAlgorithm = iota
+	// EncryptionAlgorithmSM4GCM is SM4 in GCM mode with a 12 byte nonce.
+	// The 16 byte tag is appended to the encrypted content.
+	EncryptionAlgorithmSM4GCM
+)
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []recipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type recipientInfo struct {
+	Version                int
+	IssuerAndSerialNumber  issuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"tag:0,optional"`
+}
+
+// gcmParameters are the parameters of GCM, see RFC 5084, section 3.2.
+type gcmParameters struct {
+	Nonce  []byte
+	ICVLen int `asn1:"default:12,optional"`
+}
+
+// Encrypt returns a GM/T 0010 EnvelopedData message holding content
+// encrypted with alg under a random SM4 key. The key is encrypted with SM2
+// for each of recipients, which must have SM2 public keys.
+func Encrypt(content []byte, recipients []*x509.Certificate, alg EncryptionAlgorithm) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("pkcs7: no recipients")
+	}
+
+	key := make([]byte, sm4.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	eci, err := encryptContent(content, key, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	ed := envelopedData{
+		Version:              1,
+		EncryptedContentInfo: eci,
+	}
+	for _, recipient := range recipients {
+		pub, ok := recipient.PublicKey.(*sm2.PublicKey)
+		if !ok {
+			return nil, errors.New("pkcs7: only SM2 recipients are supported")
+		}
+		encryptedKey, err := sm2.EncryptASN1(pub.PublicKey, key, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		ed.RecipientInfos = append(ed.RecipientInfos, recipientInfo{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: recipient.RawIssuer},
+				SerialNumber: recipient.SerialNumber,
+			},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidKeyEncryptionSM2},
+			EncryptedKey:           encryptedKey,
+		})
+	}
+
+	inner, err := asn1.Marshal(ed)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
+
+func encryptContent(content, key []byte, alg EncryptionAlgorithm) (encryptedContentInfo, error) {
+	eci := encryptedContentInfo{ContentType: OIDData}
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return eci, err
+	}
+
+	var params interface{}
+	var encrypted []byte
+	switch alg {
+	case EncryptionAlgorithmSM4CBC:
+		iv := make([]byte, sm4.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return eci, err
+		}
+		padding := sm4.BlockSize - len(content)%sm4.BlockSize
+		encrypted = make([]byte, len(content)+padding)
+		copy(encrypted, content)
+		copy(encrypted[len(content):], bytes.Repeat([]byte{byte(padding)}, padding))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+		eci.ContentEncryptionAlgorithm.Algorithm = oidEncryptionSM4CBC
+		params = iv
+
+	case EncryptionAlgorithmSM4GCM:
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return eci, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return eci, err
+		}
+		encrypted = aead.Seal(nil, nonce, content, nil)
+		eci.ContentEncryptionAlgorithm.Algorithm = oidEncryptionSM4GCM
+		params = gcmParameters{Nonce: nonce, ICVLen: aead.Overhead()}
+
+	default:
+		return eci, errors.New("pkcs7: unsupported content encryption algorithm")
+	}
+
+	paramsDER, err := asn1.Marshal(params)
+	if err != nil {
+		return eci, err
+	}
+	eci.ContentEncryptionAlgorithm.Parameters = asn1.RawValue{FullBytes: paramsDER}
+	eci.EncryptedContent = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: encrypted}
+	return eci, nil
+}
+
+func parseEnvelopedData(data []byte) (*PKCS7, error) {
+	var ed envelopedData
+	rest, err := asn1.Unmarshal(data, &ed)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data"}
+	}
+	return &PKCS7{
+		ContentType: ed.EncryptedContentInfo.ContentType,
+		raw:         ed,
+	}, nil
+}
+
+// Decrypt returns the content of an EnvelopedData message, using pkey, the
+// SM2 private key of the recipient certificate cert.
+func (p7 *PKCS7) Decrypt(cert *x509.Certificate, pkey crypto.PrivateKey) ([]byte, error) {
+	ed, ok := p7.raw.(envelopedData)
+	if !ok {
+		return nil, ErrNotEnvelopedData
+	}
+
+	var priv *sm2.PrivateKey
+	switch key := pkey.(type) {
+	case *sm2.PrivateKey:
+		priv = key
+	case *ecdsa.PrivateKey:
+		priv = &sm2.PrivateKey{PrivateKey: key}
+	}
+	if pub, ok := cert.PublicKey.(*sm2.PublicKey); !ok || priv == nil || !pub.Equal(priv.Public()) {
+		return nil, errors.New("pkcs7: private key does not match the recipient certificate")
+	}
+
+	var recipient *recipientInfo
+	for i := range ed.RecipientInfos {
+		ri := &ed.RecipientInfos[i]
+		if ri.IssuerAndSerialNumber.SerialNumber.Cmp(cert.SerialNumber) == 0 &&
+			bytes.Equal(ri.IssuerAndSerialNumber.IssuerName.FullBytes, cert.RawIssuer) {
+			recipient = ri
+			break
+		}
+	}
+	if recipient == nil {
+		return nil, ErrNotRecipient
+	}
+	switch alg := recipient.KeyEncryptionAlgorithm.Algorithm; {
+	case alg.Equal(oidKeyEncryptionSM2), alg.Equal(oidPublicKeySM2):
+	default:
+		return nil, fmt.Errorf("pkcs7: unsupported key encryption algorithm %v", alg)
+	}
+
+	key, err := sm2.DecryptASN1(priv, recipient.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	return decryptContent(&ed.EncryptedContentInfo, key)
+}
+
+func decryptContent(eci *encryptedContentInfo, key []byte) ([]byte, error) {
+	if len(key) != sm4.BlockSize {
+		return nil, errors.New("pkcs7: invalid content encryption key")
+	}
+	encrypted := eci.EncryptedContent
+	encrypted.Class, encrypted.Tag = asn1.ClassUniversal, asn1.TagOctetString
+	ciphertext, err := octetStringContent(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	params := eci.ContentEncryptionAlgorithm.Parameters.FullBytes
+	switch alg := eci.ContentEncryptionAlgorithm.Algorithm; {
+	case alg.Equal(oidEncryptionSM4CBC):
+		var iv []byte
+		if _, err := asn1.Unmarshal(params, &iv); err != nil || len(iv) != sm4.BlockSize {
+			return nil, errors.New("pkcs7: invalid SM4-CBC IV")
+		}
+		if len(ciphertext) == 0 || len(ciphertext)%sm4.BlockSize != 0 {
+			return nil, errors.New("pkcs7: invalid SM4-CBC content length")
+		}
+		plain := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+		return unpad(plain)
+
+	case alg.Equal(oidEncryptionSM4GCM):
+		var gcm gcmParameters
+		if _, err := asn1.Unmarshal(params, &gcm); err != nil {
+			return nil, errors.New("pkcs7: invalid SM4-GCM parameters")
+		}
+		// crypto/cipher supports a custom nonce size or a custom tag
+		// size, but not both.
+		var aead cipher.AEAD
+		switch {
+		case gcm.ICVLen == 16 && len(gcm.Nonce) > 0:
+			aead, err = cipher.NewGCMWithNonceSize(block, len(gcm.Nonce))
+		case len(gcm.Nonce) == 12 && gcm.ICVLen >= 12 && gcm.ICVLen <= 16:
+			aead, err = cipher.NewGCMWithTagSize(block, gcm.ICVLen)
+		default:
+			err = errors.New("pkcs7: unsupported SM4-GCM parameters")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return aead.Open(nil, gcm.Nonce, ciphertext, nil)
+	}
+	return nil, fmt.Errorf("pkcs7: unsupported content encryption algorithm %v", eci.ContentEncryptionAlgorithm.Algorithm)
+}
+
+// unpad removes the PKCS #7 padding of plain.
+func unpad(plain []byte) ([]byte, error) {
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > sm4.BlockSize {
+		return nil, errors.New("pkcs7: invalid padding")
+	}
+	good := 1
+	for _, b := range plain[len(plain)-padding:] {
+		good &= subtle.ConstantTimeByteEq(b, byte(padding))
+	}
+	if good != 1 {
+		return nil, errors.New("pkcs7: invalid padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,179 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pkcs7
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/rongzer/gm/x509"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	root := issueTestCert(t, "root", nil, true)
+	alice := issueTestCert(t, "alice", root, false)
+	bob := issueTestCert(t, "bob", root, false)
+	eve := issueTestCert(t, "eve", root, false)
+
+	for _, alg := range []EncryptionAlgorithm{EncryptionAlgorithmSM4CBC, EncryptionAlgorithmSM4GCM} {
+		for _, content := range [][]byte{testContent, {}, bytes.Repeat([]byte{'x'}, 16)} {
+			der, err := Encrypt(content, []*x509.Certificate{alice.cert, bob.cert}, alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(content) > 0 && bytes.Contains(der, content) {
+				t.Fatal("message contains the content")
+			}
+
+			p7, err := Parse(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !p7.ContentType.Equal(OIDData) {
+				t.Errorf("ContentType = %v, want %v", p7.ContentType, OIDData)
+			}
+			if err := p7.Verify(); err != ErrNotSignedData {
+				t.Errorf("Verify = %v, want ErrNotSignedData", err)
+			}
+
+			for _, recipient := range []*testCert{alice, bob} {
+				plain, err := p7.Decrypt(recipient.cert, recipient.key)
+				if err != nil {
+					t.Fatalf("algorithm %d: %v", alg, err)
+				}
+				if !bytes.Equal(plain, content) {
+					t.Errorf("algorithm %d: Decrypt = %q, want %q", alg, plain, content)
+				}
+			}
+			// An *ecdsa.PrivateKey on the SM2 curve works as well.
+			if _, err := p7.Decrypt(alice.cert, alice.key.PrivateKey); err != nil {
+				t.Error(err)
+			}
+
+			if _, err := p7.Decrypt(eve.cert, eve.key); err != ErrNotRecipient {
+				t.Errorf("Decrypt for another certificate = %v, want ErrNotRecipient", err)
+			}
+			if _, err := p7.Decrypt(alice.cert, bob.key); err == nil {
+				t.Error("Decrypt accepted a key that does not match the certificate")
+			}
+		}
+	}
+}
+
+func TestEncryptedStructure(t *testing.T) {
+	alice := issueTestCert(t, "alice", nil, false)
+	der, err := Encrypt(testContent, []*x509.Certificate{alice.cert}, EncryptionAlgorithmSM4CBC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.ContentType.Equal(OIDEnvelopedData) {
+		t.Errorf("content type = %v, want %v", info.ContentType, OIDEnvelopedData)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &ed); err != nil {
+		t.Fatal(err)
+	}
+	if len(ed.RecipientInfos) != 1 {
+		t.Fatalf("got %d recipients, want 1", len(ed.RecipientInfos))
+	}
+	ri := ed.RecipientInfos[0]
+	if !ri.KeyEncryptionAlgorithm.Algorithm.Equal(oidKeyEncryptionSM2) {
+		t.Errorf("key encryption algorithm = %v, want %v", ri.KeyEncryptionAlgorithm.Algorithm, oidKeyEncryptionSM2)
+	}
+	// The encrypted key is a GM/T 0009 SM2Cipher.
+	var sm2Cipher struct {
+		X, Y       *big.Int
+		Hash       []byte
+		CipherText []byte
+	}
+	if rest, err := asn1.Unmarshal(ri.EncryptedKey, &sm2Cipher); err != nil || len(rest) > 0 {
+		t.Errorf("encrypted key is not an SM2Cipher: %v", err)
+	} else if len(sm2Cipher.Hash) != 32 || len(sm2Cipher.CipherText) != 16 {
+		t.Errorf("unexpected SM2Cipher sizes %d and %d", len(sm2Cipher.Hash), len(sm2Cipher.CipherText))
+	}
+
+	eci := ed.EncryptedContentInfo
+	if !eci.ContentEncryptionAlgorithm.Algorithm.Equal(oidEncryptionSM4CBC) {
+		t.Errorf("content encryption algorithm = %v, want %v", eci.ContentEncryptionAlgorithm.Algorithm, oidEncryptionSM4CBC)
+	}
+	if eci.EncryptedContent.Class != asn1.ClassContextSpecific || eci.EncryptedContent.IsCompound ||
+		len(eci.EncryptedContent.Bytes) != 32 {
+		t.Errorf("unexpected encrypted content %+v", eci.EncryptedContent)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	alice := issueTestCert(t, "alice", nil, false)
+	for _, alg := range []EncryptionAlgorithm{EncryptionAlgorithmSM4CBC, EncryptionAlgorithmSM4GCM} {
+		der, err := Encrypt(testContent, []*x509.Certificate{alice.cert}, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p7, err := Parse(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ed := p7.raw.(envelopedData)
+		content := ed.EncryptedContentInfo.EncryptedContent.Bytes
+		content[len(content)-1] ^= 0x80
+		if plain, err := p7.Decrypt(alice.cert, alice.key); err == nil && bytes.Equal(plain, testContent) {
+			t.Errorf("algorithm %d: Decrypt returned the content of a modified message", alg)
+		}
+
+		key := ed.RecipientInfos[0].EncryptedKey
+		key[len(key)-1] ^= 1
+		if _, err := p7.Decrypt(alice.cert, alice.key); err == nil {
+			t.Errorf("algorithm %d: Decrypt accepted a modified encrypted key", alg)
+		}
+	}
+}
+
+func TestEncryptErrors(t *testing.T) {
+	if _, err := Encrypt(testContent, nil, EncryptionAlgorithmSM4CBC); err == nil {
+		t.Error("Encrypt succeeded without recipients")
+	}
+
+	alice := issueTestCert(t, "alice", nil, false)
+	if _, err := Encrypt(testContent, []*x509.Certificate{alice.cert}, EncryptionAlgorithm(42)); err == nil {
+		t.Error("Encrypt accepted an unknown algorithm")
+	}
+
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Cert := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "p256"},
+		NotAfter:     time.Now(),
+		PublicKey:    &p256Key.PublicKey,
+	}
+	if _, err := Encrypt(testContent, []*x509.Certificate{alice.cert, p256Cert}, EncryptionAlgorithmSM4CBC); err == nil {
+		t.Error("Encrypt accepted a P-256 recipient")
+	}
+
+	p7 := signTestMessage(t, SignerInfoConfig{})
+	if _, err := p7.Decrypt(alice.cert, alice.key); err != ErrNotEnvelopedData {
+		t.Errorf("Decrypt of signed data = %v, want ErrNotEnvelopedData", err)
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pkcs7
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/rongzer/gm/x509"
+)
+
+// Content types of GM/T 0010. Parse also accepts the PKCS #7 content types
+// of RFC 2315.
+var (
+	OIDData                   = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 1}
+	OIDSignedData             = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 2}
+	OIDEnvelopedData          = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 3}
+	OIDSignedAndEnvelopedData = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 4}
+	OIDEncryptedData          = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 5}
+	OIDKeyAgreementInfo       = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 6}
+
+	oidPKCS7Data          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidPKCS7EnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+)
+
+// Attribute types of PKCS #9.
+var (
+	OIDAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	OIDAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+)
+
+var (
+	oidDigestAlgorithmSM3 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401}
+
+	// SignerInfos are written with sm2-with-sm3, as GmSSL does. GM/T 0010
+	// names the SM2 signature itself, sm2-1, and some implementations
+	// write the SM2 public key algorithm; both are accepted.
+	oidSignatureSM2WithSM3 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+	oidSignatureSM2        = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301, 1}
+	oidPublicKeySM2        = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+)
+
+// ErrUnsupportedContentType is returned when a PKCS #7 content type is not
+// supported.
+var ErrUnsupportedContentType = errors.New("pkcs7: cannot parse data: unimplemented content type")
+
+// ErrNotSignedData is returned when a signed data operation is attempted on
+// a message that is not signed data.
+var ErrNotSignedData = errors.New("pkcs7: content is not signed data")
+
+// PKCS7 is a parsed message.
+type PKCS7 struct {
+	// Content is the signed content. It is nil for detached signatures
+	// until the caller sets it before calling Verify, and for enveloped
+	// data, see Decrypt.
+	Content []byte
+	// ContentType is the type of Content, OIDData in the messages created
+	// by this package.
+	ContentType  asn1.ObjectIdentifier
+	Certificates []*x509.Certificate
+	Signers      []SignerInfo
+	raw          interface{}
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version                    int                        `asn1:"default:1"`
+	DigestAlgorithmIdentifiers []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo                contentInfo
+	Certificates               asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs                       asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos                []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version                   int `asn1:"default:1"`
+	IssuerAndSerialNumber     issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+// SignerInfo describes one signature of a SignedData message.
+type SignerInfo struct {
+	// RawIssuer and SerialNumber identify the certificate of the signer.
+	RawIssuer    []byte
+	SerialNumber *big.Int
+
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	Signature                 []byte
+
+	// RawAuthenticatedAttributes is the DER encoding of the signed
+	// attributes as a SET OF, which is what the signature covers. It is
+	// nil if the signature covers the content directly.
+	RawAuthenticatedAttributes []byte
+	AuthenticatedAttributes    []Attribute
+	UnauthenticatedAttributes  []Attribute
+}
+
+// Attribute is a signed or unsigned attribute of a SignerInfo. When an
+// attribute is parsed, Value is the asn1.RawValue of its first value.
+type Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// Parse decodes a DER encoded ContentInfo holding a SignedData or an
+// EnvelopedData message.
+func Parse(data []byte) (*PKCS7, error) {
+	if len(data) == 0 {
+		return nil, errors.New("pkcs7: input data is empty")
+	}
+	var info contentInfo
+	rest, err := asn1.Unmarshal(data, &info)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data"}
+	}
+
+	switch {
+	case info.ContentType.Equal(OIDSignedData), info.ContentType.Equal(oidPKCS7SignedData):
+		return parseSignedData(info.Content.Bytes)
+	case info.ContentType.Equal(OIDEnvelopedData), info.ContentType.Equal(oidPKCS7EnvelopedData):
+		return parseEnvelopedData(info.Content.Bytes)
+	}
+	return nil, ErrUnsupportedContentType
+}
+
+func parseSignedData(data []byte) (*PKCS7, error) {
+	var sd signedData
+	rest, err := asn1.Unmarshal(data, &sd)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data"}
+	}
+
+	certs, err := parseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if len(sd.ContentInfo.Content.Bytes) > 0 {
+		// The content of the data content type is an OCTET STRING; other
+		// content types are returned as they are encoded.
+		content = sd.ContentInfo.Content.Bytes
+		if isData(sd.ContentInfo.ContentType) {
+			var octets asn1.RawValue
+			if _, err := asn1.Unmarshal(content, &octets); err != nil {
+				return nil, err
+			}
+			if content, err = octetStringContent(octets); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	signers := make([]SignerInfo, 0, len(sd.SignerInfos))
+	for _, si := range sd.SignerInfos {
+		signer, err := parseSignerInfo(&si)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	return &PKCS7{
+		Content:      content,
+		ContentType:  sd.ContentInfo.ContentType,
+		Certificates: certs,
+		Signers:      signers,
+		raw:          sd,
+	}, nil
+}
+
+func isData(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(OIDData) || oid.Equal(oidPKCS7Data)
+}
+
+// octetStringContent returns the contents of an OCTET STRING, which BER
+// allows to be constructed from segments.
+func octetStringContent(v asn1.RawValue) ([]byte, error) {
+	if v.Class != asn1.ClassUniversal || v.Tag != asn1.TagOctetString {
+		return nil, errors.New("pkcs7: content is not an OCTET STRING")
+	}
+	if !v.IsCompound {
+		return v.Bytes, nil
+	}
+	var content []byte
+	for rest := v.Bytes; len(rest) > 0; {
+		var segment asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &segment); err != nil {
+			return nil, err
+		}
+		b, err := octetStringContent(segment)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, b...)
+	}
+	return content, nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := data; len(rest) > 0; {
+		var raw asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &raw); err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+func parseSignerInfo(si *signerInfo) (SignerInfo, error) {
+	signer := SignerInfo{
+		RawIssuer:                 si.IssuerAndSerialNumber.IssuerName.FullBytes,
+		SerialNumber:              si.IssuerAndSerialNumber.SerialNumber,
+		DigestAlgorithm:           si.DigestAlgorithm,
+		DigestEncryptionAlgorithm: si.DigestEncryptionAlgorithm,
+		Signature:                 si.EncryptedDigest,
+	}
+	var err error
+	if len(si.AuthenticatedAttributes.FullBytes) > 0 {
+		// The signature is computed over the EXPLICIT SET OF encoding
+		// rather than the IMPLICIT [0] one, see RFC 2315, section 9.3.
+		signer.RawAuthenticatedAttributes, err = asn1.Marshal(asn1.RawValue{
+			Class:      asn1.ClassUniversal,
+			Tag:        asn1.TagSet,
+			IsCompound: true,
+			Bytes:      si.AuthenticatedAttributes.Bytes,
+		})
+		if err != nil {
+			return signer, err
+		}
+		if signer.AuthenticatedAttributes, err = parseAttributes(si.AuthenticatedAttributes.Bytes); err != nil {
+			return signer, err
+		}
+	}
+	if len(si.UnauthenticatedAttributes.FullBytes) > 0 {
+		if signer.UnauthenticatedAttributes, err = parseAttributes(si.UnauthenticatedAttributes.Bytes); err != nil {
+			return signer, err
+		}
+	}
+	return signer, nil
+}
+
+func parseAttributes(data []byte) ([]Attribute, error) {
+	var attrs []Attribute
+	for rest := data; len(rest) > 0; {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, err
+		}
+		var value asn1.RawValue
+		if _, err := asn1.Unmarshal(attr.Value.Bytes, &value); err != nil {
+			return nil, fmt.Errorf("pkcs7: invalid value of attribute %v: %v", attr.Type, err)
+		}
+		attrs = append(attrs, Attribute{Type: attr.Type, Value: value})
+	}
+	return attrs, nil
+}
+
+// UnmarshalSignedAttribute decodes the value of the authenticated attribute
+// attributeType of the only signer into out.
+func (p7 *PKCS7) UnmarshalSignedAttribute(attributeType asn1.ObjectIdentifier, out interface{}) error {
+	if len(p7.Signers) != 1 {
+		return errors.New("pkcs7: message does not have exactly one signer")
+	}
+	return unmarshalAttribute(p7.Signers[0].AuthenticatedAttributes, attributeType, out)
+}
+
+func unmarshalAttribute(attrs []Attribute, attributeType asn1.ObjectIdentifier, out interface{}) error {
+	for _, attr := range attrs {
+		if !attr.Type.Equal(attributeType) {
+			continue
+		}
+		value, ok := attr.Value.(asn1.RawValue)
+		if !ok {
+			return fmt.Errorf("pkcs7: attribute %v is not parsed", attributeType)
+		}
+		rest, err := asn1.Unmarshal(value.FullBytes, out)
+		if err != nil {
+			return err
+		}
+		if len(rest) > 0 {
+			return asn1.SyntaxError{Msg: "trailing data"}
+		}
+		return nil
+	}
+	return errAttributeNotFound
+}
+
+var errAttributeNotFound = errors.New("pkcs7: attribute not found")
+
+// marshalAttributes returns the DER encoding of attrs as a SET OF, sorted
+// as DER requires.
+func marshalAttributes(attrs []Attribute) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attrs))
+	for _, attr := range attrs {
+		value, err := asn1.Marshal(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		der, err := asn1.Marshal(attribute{
+			Type: attr.Type,
+			Value: asn1.RawValue{
+				Class:      asn1.ClassUniversal,
+				Tag:        asn1.TagSet,
+				IsCompound: true,
+				Bytes:      value,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, der)
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      bytes.Join(encoded, nil),
+	})
+}
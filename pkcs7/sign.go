@@ -0,0 +1,210 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"time"
+
+	"github.com/rongzer/gm/sm2"
+	"github.com/rongzer/gm/sm3"
+	"github.com/rongzer/gm/x509"
+)
+
+// SignedData is a GM/T 0010 SignedData message under construction. Signers
+// are added with AddSigner and the message is encoded by Finish.
+type SignedData struct {
+	sd     signedData
+	certs  []*x509.Certificate
+	data   []byte
+	digest []byte
+	detach bool
+}
+
+// SignerInfoConfig holds the attributes of a signer added by AddSigner.
+type SignerInfoConfig struct {
+	// ExtraSignedAttributes are signed along with the content type, message
+	// digest and signing time attributes.
+	ExtraSignedAttributes []Attribute
+	// ExtraUnsignedAttributes are added to the SignerInfo without being
+	// signed.
+	ExtraUnsignedAttributes []Attribute
+	// SigningTime is the value of the signing time attribute. If zero, the
+	// current time is used.
+	SigningTime time.Time
+	// NoSignedAttributes signs the content itself instead of the signed
+	// attributes, which are omitted. It cannot be combined with
+	// ExtraSignedAttributes.
+	NoSignedAttributes bool
+}
+
+// NewSignedData returns a SignedData message for data, of the GM/T 0010
+// data content type.
+func NewSignedData(data []byte) (*SignedData, error) {
+	content, err := asn1.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	digest := sm3.SumSM3(data)
+	return &SignedData{
+		sd: signedData{
+			Version:                    1,
+			DigestAlgorithmIdentifiers: []pkix.AlgorithmIdentifier{{Algorithm: oidDigestAlgorithmSM3}},
+			ContentInfo: contentInfo{
+				ContentType: OIDData,
+				Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+			},
+		},
+		data:   data,
+		digest: digest[:],
+	}, nil
+}
+
+// AddSigner signs the content with pkey, the SM2 private key of ee, and
+// adds ee to the certificates of the message.
+func (sd *SignedData) AddSigner(ee *x509.Certificate, pkey crypto.PrivateKey, config SignerInfoConfig) error {
+	return sd.AddSignerChain(ee, pkey, nil, config)
+}
+
+// AddSignerChain is like AddSigner, but also adds the certificates of the
+// chain of ee, excluding the root, so that verifiers only need the root.
+func (sd *SignedData) AddSignerChain(ee *x509.Certificate, pkey crypto.PrivateKey, parents []*x509.Certificate, config SignerInfoConfig) error {
+	signer, err := signingKey(ee, pkey)
+	if err != nil {
+		return err
+	}
+	if config.NoSignedAttributes && len(config.ExtraSignedAttributes) > 0 {
+		return errors.New("pkcs7: extra signed attributes require signed attributes")
+	}
+
+	si := signerInfo{
+		Version: 1,
+		IssuerAndSerialNumber: issuerAndSerial{
+			IssuerName:   asn1.RawValue{FullBytes: ee.RawIssuer},
+			SerialNumber: ee.SerialNumber,
+		},
+		DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidDigestAlgorithmSM3},
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSignatureSM2WithSM3},
+	}
+
+	signed := sd.data
+	if !config.NoSignedAttributes {
+		signingTime := config.SigningTime
+		if signingTime.IsZero() {
+			signingTime = time.Now()
+		}
+		attrs := append([]Attribute{
+			{Type: OIDAttributeContentType, Value: sd.sd.ContentInfo.ContentType},
+			{Type: OIDAttributeMessageDigest, Value: sd.digest},
+			{Type: OIDAttributeSigningTime, Value: signingTime.UTC()},
+		}, config.ExtraSignedAttributes...)
+		if signed, err = marshalAttributes(attrs); err != nil {
+			return err
+		}
+		// signed is a SET OF; it is stored with the IMPLICIT [0] tag.
+		si.AuthenticatedAttributes = asn1.RawValue{FullBytes: append([]byte{0xa0}, signed[1:]...)}
+	}
+	if len(config.ExtraUnsignedAttributes) > 0 {
+		unsigned, err := marshalAttributes(config.ExtraUnsignedAttributes)
+		if err != nil {
+			return err
+		}
+		si.UnauthenticatedAttributes = asn1.RawValue{FullBytes: append([]byte{0xa1}, unsigned[1:]...)}
+	}
+
+	if si.EncryptedDigest, err = signer.Sign(rand.Reader, signed, &sm2.SignerOpts{}); err != nil {
+		return err
+	}
+
+	sd.sd.SignerInfos = append(sd.sd.SignerInfos, si)
+	sd.AddCertificate(ee)
+	for _, parent := range parents {
+		sd.AddCertificate(parent)
+	}
+	return nil
+}
+
+// signingKey returns pkey as a crypto.Signer that computes SM2 signatures,
+// after checking that it matches the public key of ee.
+func signingKey(ee *x509.Certificate, pkey crypto.PrivateKey) (crypto.Signer, error) {
+	var signer crypto.Signer
+	switch key := pkey.(type) {
+	case *sm2.PrivateKey:
+		signer = key
+	case *ecdsa.PrivateKey:
+		if key.Curve == nil || key.Params() != sm2.Curve().Params() {
+			return nil, errors.New("pkcs7: only SM2 keys are supported")
+		}
+		signer = &sm2.PrivateKey{PrivateKey: key}
+	case crypto.Signer:
+		if _, ok := key.Public().(*sm2.PublicKey); !ok {
+			return nil, errors.New("pkcs7: only SM2 keys are supported")
+		}
+		signer = key
+	default:
+		return nil, errors.New("pkcs7: only SM2 keys are supported")
+	}
+
+	pub, ok := ee.PublicKey.(*sm2.PublicKey)
+	if !ok || !pub.Equal(signer.Public()) {
+		return nil, errors.New("pkcs7: private key does not match the signer certificate")
+	}
+	return signer, nil
+}
+
+// AddCertificate adds cert to the certificates of the message, unless it
+// is already there.
+func (sd *SignedData) AddCertificate(cert *x509.Certificate) {
+	for _, c := range sd.certs {
+		if c.Equal(cert) {
+			return
+		}
+	}
+	sd.certs = append(sd.certs, cert)
+}
+
+// Detach removes the content from the message, so that it is verified
+// against content transmitted separately.
+func (sd *SignedData) Detach() {
+	sd.detach = true
+}
+
+// Finish returns the DER encoded ContentInfo of the message.
+func (sd *SignedData) Finish() ([]byte, error) {
+	if len(sd.sd.SignerInfos) == 0 {
+		return nil, errors.New("pkcs7: no signers")
+	}
+	out := sd.sd
+	if sd.detach {
+		out.ContentInfo.Content = asn1.RawValue{}
+	}
+	if len(sd.certs) > 0 {
+		var raw bytes.Buffer
+		for _, cert := range sd.certs {
+			raw.Write(cert.Raw)
+		}
+		out.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw.Bytes()}
+	}
+	inner, err := asn1.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
@@ -0,0 +1,293 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pkcs7
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/rongzer/gm/sm2"
+	"github.com/rongzer/gm/x509"
+)
+
+var testContent = []byte("GM/T 0010 signed content")
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *sm2.PrivateKey
+}
+
+// issueTestCert returns an SM2 certificate for name issued by parent, or
+// a self-signed CA certificate if parent is nil.
+func issueTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert, key}
+}
+
+func TestSignAttached(t *testing.T) {
+	root := issueTestCert(t, "root", nil, true)
+	signer := issueTestCert(t, "signer", root, false)
+
+	sd, err := NewSignedData(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := sd.AddSigner(signer.cert, signer.key, SignerInfoConfig{SigningTime: signingTime}); err != nil {
+		t.Fatal(err)
+	}
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p7, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p7.Content, testContent) {
+		t.Errorf("Content = %q, want %q", p7.Content, testContent)
+	}
+	if !p7.ContentType.Equal(OIDData) {
+		t.Errorf("ContentType = %v, want %v", p7.ContentType, OIDData)
+	}
+	if err := p7.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if cert := p7.GetOnlySigner(); cert == nil || !cert.Equal(signer.cert) {
+		t.Error("GetOnlySigner did not return the signer certificate")
+	}
+
+	var got time.Time
+	if err := p7.UnmarshalSignedAttribute(OIDAttributeSigningTime, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(signingTime) {
+		t.Errorf("signing time = %v, want %v", got, signingTime)
+	}
+
+	si := p7.Signers[0]
+	if !si.DigestAlgorithm.Algorithm.Equal(oidDigestAlgorithmSM3) ||
+		!si.DigestEncryptionAlgorithm.Algorithm.Equal(oidSignatureSM2WithSM3) {
+		t.Errorf("unexpected algorithms %v and %v", si.DigestAlgorithm.Algorithm, si.DigestEncryptionAlgorithm.Algorithm)
+	}
+
+	// The outer ContentInfo uses the GM/T 0010 SignedData content type.
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.ContentType.Equal(OIDSignedData) {
+		t.Errorf("content type = %v, want %v", info.ContentType, OIDSignedData)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	if err := p7.VerifyWithChain(roots); err != nil {
+		t.Errorf("VerifyWithChain: %v", err)
+	}
+	other := x509.NewCertPool()
+	other.AddCert(issueTestCert(t, "root", nil, true).cert)
+	if err := p7.VerifyWithChain(other); err == nil {
+		t.Error("VerifyWithChain accepted an untrusted signer")
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	signer := issueTestCert(t, "signer", nil, false)
+
+	sd, err := NewSignedData(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.AddSigner(signer.cert, signer.key, SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	sd.Detach()
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(der, testContent) {
+		t.Error("detached message contains the content")
+	}
+
+	p7, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p7.Content != nil {
+		t.Errorf("Content = %q, want nil", p7.Content)
+	}
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify succeeded without the content")
+	}
+	p7.Content = []byte("other content")
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify succeeded with other content")
+	}
+	p7.Content = testContent
+	if err := p7.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignWithoutSignedAttributes(t *testing.T) {
+	signer := issueTestCert(t, "signer", nil, false)
+
+	sd, err := NewSignedData(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An *ecdsa.PrivateKey on the SM2 curve signs with SM2 as well.
+	if err := sd.AddSigner(signer.cert, signer.key.PrivateKey, SignerInfoConfig{NoSignedAttributes: true}); err != nil {
+		t.Fatal(err)
+	}
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si := p7.Signers[0]; si.RawAuthenticatedAttributes != nil || si.AuthenticatedAttributes != nil {
+		t.Error("message has signed attributes")
+	}
+	if err := p7.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	p7.Content = []byte("other content")
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify succeeded with other content")
+	}
+}
+
+func TestSignMultipleSignersWithChain(t *testing.T) {
+	root := issueTestCert(t, "root", nil, true)
+	intermediate := issueTestCert(t, "intermediate", root, true)
+	first := issueTestCert(t, "first", intermediate, false)
+	second := issueTestCert(t, "second", root, false)
+
+	oidCustom := asn1.ObjectIdentifier{1, 2, 3, 4}
+	sd, err := NewSignedData(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.AddSignerChain(first.cert, first.key, []*x509.Certificate{intermediate.cert}, SignerInfoConfig{
+		ExtraSignedAttributes:   []Attribute{{Type: oidCustom, Value: "signed"}},
+		ExtraUnsignedAttributes: []Attribute{{Type: oidCustom, Value: "unsigned"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.AddSigner(second.cert, second.key, SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	sd.AddCertificate(second.cert)
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p7, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p7.Signers) != 2 || len(p7.Certificates) != 3 {
+		t.Fatalf("got %d signers and %d certificates, want 2 and 3", len(p7.Signers), len(p7.Certificates))
+	}
+	if p7.GetOnlySigner() != nil {
+		t.Error("GetOnlySigner returned a certificate for two signers")
+	}
+
+	// SignerInfos is a SET OF, which DER does not keep in insertion order.
+	si := p7.Signers[0]
+	if si.SerialNumber.Cmp(first.cert.SerialNumber) != 0 {
+		si = p7.Signers[1]
+	}
+	var value string
+	if err := unmarshalAttribute(si.AuthenticatedAttributes, oidCustom, &value); err != nil || value != "signed" {
+		t.Errorf("signed attribute = %q, %v", value, err)
+	}
+	if err := unmarshalAttribute(si.UnauthenticatedAttributes, oidCustom, &value); err != nil || value != "unsigned" {
+		t.Errorf("unsigned attribute = %q, %v", value, err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	if err := p7.VerifyWithChain(roots); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	signer := issueTestCert(t, "signer", nil, false)
+	other := issueTestCert(t, "other", nil, false)
+
+	sd, err := NewSignedData(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sd.Finish(); err == nil {
+		t.Error("Finish succeeded without signers")
+	}
+	if err := sd.AddSigner(signer.cert, other.key, SignerInfoConfig{}); err == nil {
+		t.Error("AddSigner accepted a key that does not match the certificate")
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.AddSigner(signer.cert, p256Key, SignerInfoConfig{}); err == nil {
+		t.Error("AddSigner accepted a P-256 key")
+	}
+	if err := sd.AddSigner(signer.cert, signer.key, SignerInfoConfig{
+		NoSignedAttributes:    true,
+		ExtraSignedAttributes: []Attribute{{Type: OIDAttributeSigningTime, Value: time.Now()}},
+	}); err == nil {
+		t.Error("AddSigner accepted extra signed attributes without signed attributes")
+	}
+}
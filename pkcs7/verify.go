@@ -0,0 +1,136 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pkcs7
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rongzer/gm/sm3"
+	"github.com/rongzer/gm/x509"
+)
+
+// Verify checks the signatures of all signers of the message against the
+// certificates it carries. For a detached signature, p7.Content must be set
+// to the signed content first. Verify does not check that the certificates
+// are trusted, see VerifyWithChain.
+func (p7 *PKCS7) Verify() error {
+	return p7.VerifyWithChain(nil)
+}
+
+// VerifyWithChain is like Verify, but also checks that the certificate of
+// each signer chains up to truststore, using the other certificates of the
+// message as intermediates. Certificates are checked at the signing time
+// attribute of the signer, or at the current time if it has none. Nothing
+// is checked beyond Verify if truststore is nil.
+func (p7 *PKCS7) VerifyWithChain(truststore *x509.CertPool) error {
+	if _, ok := p7.raw.(signedData); !ok {
+		return ErrNotSignedData
+	}
+	if len(p7.Signers) == 0 {
+		return errors.New("pkcs7: message has no signers")
+	}
+	for i := range p7.Signers {
+		if err := p7.verifySigner(&p7.Signers[i], truststore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p7 *PKCS7) verifySigner(signer *SignerInfo, truststore *x509.CertPool) error {
+	ee := p7.signerCertificate(signer)
+	if ee == nil {
+		return errors.New("pkcs7: no certificate for signer")
+	}
+	if !signer.DigestAlgorithm.Algorithm.Equal(oidDigestAlgorithmSM3) {
+		return fmt.Errorf("pkcs7: unsupported digest algorithm %v", signer.DigestAlgorithm.Algorithm)
+	}
+	switch alg := signer.DigestEncryptionAlgorithm.Algorithm; {
+	case alg.Equal(oidSignatureSM2WithSM3), alg.Equal(oidSignatureSM2), alg.Equal(oidPublicKeySM2):
+	default:
+		return fmt.Errorf("pkcs7: unsupported signature algorithm %v", alg)
+	}
+
+	signed := p7.Content
+	var signingTime time.Time
+	if signer.RawAuthenticatedAttributes != nil {
+		var contentType asn1.ObjectIdentifier
+		if err := unmarshalAttribute(signer.AuthenticatedAttributes, OIDAttributeContentType, &contentType); err != nil {
+			return fmt.Errorf("pkcs7: missing content type attribute: %v", err)
+		}
+		if !contentType.Equal(p7.ContentType) {
+			return errors.New("pkcs7: content type attribute does not match the content")
+		}
+		var digest []byte
+		if err := unmarshalAttribute(signer.AuthenticatedAttributes, OIDAttributeMessageDigest, &digest); err != nil {
+			return fmt.Errorf("pkcs7: missing message digest attribute: %v", err)
+		}
+		computed := sm3.SumSM3(p7.Content)
+		if !bytes.Equal(digest, computed[:]) {
+			return errors.New("pkcs7: message digest mismatch")
+		}
+
+		err := unmarshalAttribute(signer.AuthenticatedAttributes, OIDAttributeSigningTime, &signingTime)
+		if err != nil && err != errAttributeNotFound {
+			return err
+		}
+		if err == nil && (signingTime.Before(ee.NotBefore) || signingTime.After(ee.NotAfter)) {
+			return fmt.Errorf("pkcs7: signing time %q is outside of certificate validity %q to %q",
+				signingTime.Format(time.RFC3339), ee.NotBefore.Format(time.RFC3339), ee.NotAfter.Format(time.RFC3339))
+		}
+		signed = signer.RawAuthenticatedAttributes
+	}
+
+	if err := ee.CheckSignature(x509.SM2WithSM3, signed, signer.Signature); err != nil {
+		return err
+	}
+
+	if truststore != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range p7.Certificates {
+			intermediates.AddCert(cert)
+		}
+		opts := x509.VerifyOptions{
+			Roots:         truststore,
+			Intermediates: intermediates,
+			CurrentTime:   signingTime,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		if _, err := ee.Verify(opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signerCertificate returns the certificate of the message identified by
+// the issuer and serial number of signer.
+func (p7 *PKCS7) signerCertificate(signer *SignerInfo) *x509.Certificate {
+	for _, cert := range p7.Certificates {
+		if cert.SerialNumber.Cmp(signer.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, signer.RawIssuer) {
+			return cert
+		}
+	}
+	return nil
+}
+
+// GetOnlySigner returns the certificate of the signer of a message with a
+// single signer, or nil.
+func (p7 *PKCS7) GetOnlySigner() *x509.Certificate {
+	if len(p7.Signers) != 1 {
+		return nil
+	}
+	return p7.signerCertificate(&p7.Signers[0])
+}
@@ -0,0 +1,243 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pkcs7
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/rongzer/gm/x509"
+)
+
+// signTestMessage returns the parsed message of testContent signed by a
+// new self-signed certificate with config.
+func signTestMessage(t *testing.T, config SignerInfoConfig) *PKCS7 {
+	t.Helper()
+	signer := issueTestCert(t, "signer", nil, false)
+	sd, err := NewSignedData(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.AddSigner(signer.cert, signer.key, config); err != nil {
+		t.Fatal(err)
+	}
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p7
+}
+
+func TestVerifyTampered(t *testing.T) {
+	p7 := signTestMessage(t, SignerInfoConfig{})
+	p7.Signers[0].Signature[len(p7.Signers[0].Signature)-1] ^= 1
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify accepted a modified signature")
+	}
+
+	p7 = signTestMessage(t, SignerInfoConfig{})
+	p7.Signers[0].RawAuthenticatedAttributes[len(p7.Signers[0].RawAuthenticatedAttributes)-1] ^= 1
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify accepted modified signed attributes")
+	}
+
+	p7 = signTestMessage(t, SignerInfoConfig{})
+	p7.ContentType = OIDSignedData
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify accepted a different content type")
+	}
+
+	p7 = signTestMessage(t, SignerInfoConfig{})
+	p7.Certificates = nil
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify succeeded without the signer certificate")
+	}
+}
+
+func TestVerifySigningTime(t *testing.T) {
+	p7 := signTestMessage(t, SignerInfoConfig{SigningTime: time.Now().Add(-24 * time.Hour)})
+	if err := p7.Verify(); err == nil {
+		t.Error("Verify accepted a signing time before the certificate validity")
+	}
+}
+
+// TestParsePKCS7ContentTypes checks that messages using the RFC 2315
+// content types rather than the GM/T 0010 ones are accepted.
+func TestParsePKCS7ContentTypes(t *testing.T) {
+	signer := issueTestCert(t, "signer", nil, false)
+	sd, err := NewSignedData(testContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd.sd.ContentInfo.ContentType = oidPKCS7Data
+	if err := sd.AddSigner(signer.cert, signer.key, SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	sd.AddCertificate(signer.cert)
+	inner, err := asn1.Marshal(signedData{
+		Version:                    1,
+		DigestAlgorithmIdentifiers: []pkix.AlgorithmIdentifier{{Algorithm: oidDigestAlgorithmSM3}},
+		ContentInfo:                sd.sd.ContentInfo,
+		Certificates:               asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signer.cert.Raw},
+		SignerInfos:                sd.sd.SignerInfos,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(contentInfo{
+		ContentType: oidPKCS7SignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p7, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p7.Content) != string(testContent) || !p7.ContentType.Equal(oidPKCS7Data) {
+		t.Errorf("Content = %q of type %v", p7.Content, p7.ContentType)
+	}
+	if err := p7.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseUnsupportedContentType(t *testing.T) {
+	der, err := asn1.Marshal(contentInfo{ContentType: OIDEncryptedData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(der); err != ErrUnsupportedContentType {
+		t.Errorf("Parse = %v, want ErrUnsupportedContentType", err)
+	}
+	if _, err := Parse(nil); err == nil {
+		t.Error("Parse accepted empty input")
+	}
+}
+
+// SignedData messages of "hello, SM2 CMS\n" in the layout written by GmSSL:
+// GM/T 0010 content types, sm3 and sm2-with-sm3 algorithms and content
+// type, signing time and message digest attributes, signed with DefaultID.
+// The certificate was made by
+//
+//	openssl req -new -x509 -key key.pem -sm3 -sigopt distid:1234567812345678
+//
+// and the signed attributes signed by
+//
+//	openssl pkeyutl -sign -rawin -digest sm3 -pkeyopt distid:1234567812345678
+//
+// since OpenSSL 3.0 cannot write SM2 SignedData itself. The signing times
+// are 2026-10-19 08:00 and 09:00 UTC.
+//
+// To check a message from NewSignedData and Finish against GmSSL 3, encode
+// it as PEM of type "CMS" and run:
+//
+//	gmssl cms -verify -in signed.pem -out content.txt
+const (
+	externalAttachedHex = "308202c8060a2a811ccf550601040202a08202b8308202b4020101310c300a06" +
+		"082a811ccf55018311301f060a2a811ccf550601040201a011040f68656c6c6f" +
+		"2c20534d3220434d530aa08201833082017f30820125a0030201020202123430" +
+		"0a06082a811ccf55018375301d311b301906035504030c124f70656e53534c20" +
+		"534d32207369676e65723020170d3236313031383133303833385a180f323132" +
+		"36303932343133303833385a301d311b301906035504030c124f70656e53534c" +
+		"20534d32207369676e65723059301306072a8648ce3d020106082a811ccf5501" +
+		"822d0342000429a2149281f985b62d4e58f5297439d5dc0aade09ea4f8bd5df4" +
+		"7a442ac0574d179b7e4cf23e8fe63f9bc980c87fd384b8180c320c67e7539e17" +
+		"2e8f25184c9aa3533051301d0603551d0e04160414e8c3b4143e79c6111f5848" +
+		"7678e57d1d7564bcdd301f0603551d23041830168014e8c3b4143e79c6111f58" +
+		"487678e57d1d7564bcdd300f0603551d130101ff040530030101ff300a06082a" +
+		"811ccf55018375034800304502201750849fd80fbc7fac6c04150ff7b556517f" +
+		"5b054e2306ae62e732d2c8a14892022100d964f3ad179730f2e03eb25b7b8771" +
+		"e10f6d9dd8ad4e2707e75ebc7bf65f9cd43181f83081f50201013023301d311b" +
+		"301906035504030c124f70656e53534c20534d32207369676e65720202123430" +
+		"0a06082a811ccf55018311a06a301906092a864886f70d010903310c060a2a81" +
+		"1ccf550601040201301c06092a864886f70d010905310f170d32363130313930" +
+		"38303030305a302f06092a864886f70d01090431220420892de69cd55ac68047" +
+		"f8eb84d36e01b8d9221284e135a702ec3cc388dd59379c300a06082a811ccf55" +
+		"01837504473045022100ee94463a18f77ee0b791b9783d0558495ea84f3a4b90" +
+		"2aea1b2c2e98ebc14a5f022056c4de7fbf9fd118dc787cc22f94850d574b7c0d" +
+		"915c679191160d13b36c5a9e"
+
+	externalDetachedHex = "308202b5060a2a811ccf550601040202a08202a5308202a1020101310c300a06" +
+		"082a811ccf55018311300c060a2a811ccf550601040201a08201833082017f30" +
+		"820125a00302010202021234300a06082a811ccf55018375301d311b30190603" +
+		"5504030c124f70656e53534c20534d32207369676e65723020170d3236313031" +
+		"383133303833385a180f32313236303932343133303833385a301d311b301906" +
+		"035504030c124f70656e53534c20534d32207369676e65723059301306072a86" +
+		"48ce3d020106082a811ccf5501822d0342000429a2149281f985b62d4e58f529" +
+		"7439d5dc0aade09ea4f8bd5df47a442ac0574d179b7e4cf23e8fe63f9bc980c8" +
+		"7fd384b8180c320c67e7539e172e8f25184c9aa3533051301d0603551d0e0416" +
+		"0414e8c3b4143e79c6111f58487678e57d1d7564bcdd301f0603551d23041830" +
+		"168014e8c3b4143e79c6111f58487678e57d1d7564bcdd300f0603551d130101" +
+		"ff040530030101ff300a06082a811ccf55018375034800304502201750849fd8" +
+		"0fbc7fac6c04150ff7b556517f5b054e2306ae62e732d2c8a14892022100d964" +
+		"f3ad179730f2e03eb25b7b8771e10f6d9dd8ad4e2707e75ebc7bf65f9cd43181" +
+		"f83081f50201013023301d311b301906035504030c124f70656e53534c20534d" +
+		"32207369676e657202021234300a06082a811ccf55018311a06a301906092a86" +
+		"4886f70d010903310c060a2a811ccf550601040201301c06092a864886f70d01" +
+		"0905310f170d3236313031393039303030305a302f06092a864886f70d010904" +
+		"31220420892de69cd55ac68047f8eb84d36e01b8d9221284e135a702ec3cc388" +
+		"dd59379c300a06082a811ccf5501837504473045022100cf615c3d5325e232ed" +
+		"4aba34abc50a87e20ff58c1ea46c56b9087a53e814c1c002202c704be2cb1275" +
+		"aca7e1e48176aa8a4803208b100df7b048a321d06a2f2da9f5"
+)
+
+func TestVerifyExternal(t *testing.T) {
+	content := []byte("hello, SM2 CMS\n")
+	for _, test := range []struct {
+		name     string
+		der      string
+		detached bool
+	}{
+		{"attached", externalAttachedHex, false},
+		{"detached", externalDetachedHex, true},
+	} {
+		der, err := hex.DecodeString(test.der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p7, err := Parse(der)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if test.detached {
+			if p7.Content != nil {
+				t.Errorf("%s: content = %q, want none", test.name, p7.Content)
+			}
+			p7.Content = content
+		} else if !bytes.Equal(p7.Content, content) {
+			t.Errorf("%s: content = %q, want %q", test.name, p7.Content, content)
+		}
+		if err := p7.Verify(); err != nil {
+			t.Errorf("%s: Verify: %v", test.name, err)
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(p7.Certificates[0])
+		if err := p7.VerifyWithChain(roots); err != nil {
+			t.Errorf("%s: VerifyWithChain: %v", test.name, err)
+		}
+
+		p7.Content = []byte("hello, SM2 CMS!")
+		if err := p7.Verify(); err == nil {
+			t.Errorf("%s: Verify accepted other content", test.name)
+		}
+	}
+}
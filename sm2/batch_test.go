@@ -0,0 +1,211 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func newBatch(t testing.TB, n int) []BatchEntry {
+	keys := make([]*PrivateKey, 3)
+	for i := range keys {
+		var err error
+		if keys[i], err = GenerateKey(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := make([]BatchEntry, n)
+	for i := range entries {
+		priv := keys[i%len(keys)]
+		msg := []byte(fmt.Sprintf("message %d", i))
+		entry := BatchEntry{PublicKey: &priv.PublicKey, Message: msg}
+		var err error
+		if i%2 == 0 {
+			entry.R, entry.S, err = Sign(priv, msg)
+		} else {
+			entry.R, entry.S, err = SignWithID(priv, msg, DefaultID)
+			if err == nil {
+				entry.Digest, err = CalculateDigest(&priv.PublicKey, msg, DefaultID)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[i] = entry
+	}
+	return entries
+}
+
+func TestVerifyBatch(t *testing.T) {
+	entries := newBatch(t, 20)
+	if ok, failed := VerifyBatch(entries); !ok || failed != nil {
+		t.Fatalf("VerifyBatch = %v, %v; want true, nil", ok, failed)
+	}
+	if ok, failed := VerifyBatch(nil); !ok || failed != nil {
+		t.Errorf("VerifyBatch(nil) = %v, %v; want true, nil", ok, failed)
+	}
+
+	entries[4].Message = []byte("another message")
+	entries[7].S = new(big.Int).Add(entries[7].S, big.NewInt(1))
+	entries[9].Digest[0] ^= 1
+	entries[12].R = new(big.Int)
+	entries[15].PublicKey = nil
+	entries[19].PublicKey = entries[18].PublicKey
+	want := []int{4, 7, 9, 12, 15, 19}
+
+	ok, failed := VerifyBatch(entries)
+	if ok || !reflect.DeepEqual(failed, want) {
+		t.Fatalf("VerifyBatch = %v, %v; want false, %v", ok, failed, want)
+	}
+	for i, e := range entries {
+		if e.PublicKey == nil {
+			continue
+		}
+		var valid bool
+		if e.Digest != nil {
+			valid = VerifyDigest(e.PublicKey, e.Digest, e.R, e.S)
+		} else {
+			valid = Verify(e.PublicKey, e.Message, e.R, e.S)
+		}
+		if ok, _ := VerifyBatch(entries[i : i+1]); ok != valid {
+			t.Errorf("#%d: VerifyBatch = %v, Verify = %v", i, ok, valid)
+		}
+	}
+}
+
+func TestVerifyBatchRandom(t *testing.T) {
+	priv, _ := GenerateKey()
+	for i := 0; i < 50; i++ {
+		digest := make([]byte, 32)
+		rand.Read(digest)
+		r, _ := rand.Int(rand.Reader, sm2Curve.N)
+		s, _ := rand.Int(rand.Reader, sm2Curve.N)
+		e := BatchEntry{PublicKey: &priv.PublicKey, Digest: digest, R: r, S: s}
+		if ok, _ := VerifyBatch([]BatchEntry{e}); ok != VerifyDigest(&priv.PublicKey, digest, r, s) {
+			t.Errorf("VerifyBatch and VerifyDigest disagree on r = %x, s = %x", r, s)
+		}
+	}
+}
+
+// TestVerifyBatchLargeX checks a signature for which x1 of [s]G + [t]P is
+// in [n, p), so that r - e ≡ x1 - n modulo n.
+func TestVerifyBatchLargeX(t *testing.T) {
+	c := Curve()
+	params := c.Params()
+
+	// Find a point Q whose x coordinate is at least n.
+	x := new(big.Int).Sub(params.N, big.NewInt(1))
+	var y *big.Int
+	for y == nil {
+		x.Add(x, big.NewInt(1))
+		y2 := new(big.Int).Exp(x, big.NewInt(3), params.P)
+		y2.Sub(y2, new(big.Int).Mul(x, big.NewInt(3)))
+		y2.Add(y2, params.B)
+		y2.Mod(y2, params.P)
+		y = new(big.Int).ModSqrt(y2, params.P)
+	}
+
+	// Pick s and t, and P = t⁻¹(Q - [s]G) so that [s]G + [t]P = Q.
+	s := big.NewInt(12345)
+	tt := big.NewInt(67890)
+	gx, gy := c.ScalarBaseMult(new(big.Int).Sub(params.N, s).Bytes())
+	px, py := c.Add(x, y, gx, gy)
+	px, py = c.ScalarMult(px, py, new(big.Int).ModInverse(tt, params.N).Bytes())
+	pub := &ecdsa.PublicKey{Curve: c, X: px, Y: py}
+
+	r := new(big.Int).Sub(tt, s)
+	r.Mod(r, params.N)
+	e := new(big.Int).Sub(r, x)
+	e.Mod(e, params.N)
+	digest := e.Bytes()
+
+	if !VerifyDigest(pub, digest, r, s) {
+		t.Fatal("VerifyDigest failed")
+	}
+	if ok, _ := VerifyBatch([]BatchEntry{{PublicKey: pub, Digest: digest, R: r, S: s}}); !ok {
+		t.Error("VerifyBatch failed")
+	}
+}
+
+// TestAffineWindowMult checks affineWindowMult against scalarMult.
+func TestAffineWindowMult(t *testing.T) {
+	priv, _ := GenerateKey()
+	multiples := appendMultiples(nil, &priv.PublicKey)
+	table := make([]uint64, 16*8)
+	batchToAffine(table, multiples)
+
+	N := sm2Curve.Params().N
+	scalars := []*big.Int{big.NewInt(1), big.NewInt(31), big.NewInt(32), new(big.Int).Sub(N, big.NewInt(1))}
+	for i := 0; i < 20; i++ {
+		k, _ := rand.Int(rand.Reader, N)
+		scalars = append(scalars, k)
+	}
+	for _, k := range scalars {
+		var limbs [4]uint64
+		fromBig(limbs[:], k)
+		var got, want point
+		got.affineWindowMult(table, limbs[:])
+		copy(want.xyz[:], multiples[0:12])
+		want.scalarMult(limbs[:])
+		gotX, gotY := got.pointToAffine()
+		wantX, wantY := want.pointToAffine()
+		if gotX.Cmp(wantX) != 0 || gotY.Cmp(wantY) != 0 {
+			t.Errorf("[%x]P = (%x, %x), want (%x, %x)", k, gotX, gotY, wantX, wantY)
+		}
+	}
+}
+
+// TestVerifyBatchOffCurve checks that an entry whose key is not on the
+// curve fails without affecting the other entries.
+func TestVerifyBatchOffCurve(t *testing.T) {
+	entries := newBatch(t, 4)
+	pub := *entries[1].PublicKey
+	pub.Y = new(big.Int).Add(pub.Y, big.NewInt(1))
+	entries[1].PublicKey = &pub
+	if ok, failed := VerifyBatch(entries); ok || !reflect.DeepEqual(failed, []int{1}) {
+		t.Errorf("VerifyBatch = %v, %v; want false, [1]", ok, failed)
+	}
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	entries := newBatch(b, 64)
+
+	b.Run("sequential", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, e := range entries {
+				var ok bool
+				if e.Digest != nil {
+					ok = VerifyDigest(e.PublicKey, e.Digest, e.R, e.S)
+				} else {
+					ok = Verify(e.PublicKey, e.Message, e.R, e.S)
+				}
+				if !ok {
+					b.Fatal("verification failed")
+				}
+			}
+		}
+	})
+
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if ok, _ := VerifyBatch(entries); !ok {
+				b.Fatal("verification failed")
+			}
+		}
+	})
+}
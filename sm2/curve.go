@@ -56,10 +56,6 @@ func (c curve) Inverse(k *big.Int) *big.Int {
 		k = new(big.Int).Mod(k, sm2Curve.N)
 	}
 
-	// table will store precomputed powers of x. The four words at index
-	// 4×i store x^(i+1).
-	var table [4 * 15]uint64
-
 	x := make([]uint64, 4)
 	fromBig(x[:], k)
 	// This code operates in the Montgomery domain where R = 2^256 mod n
@@ -68,8 +64,36 @@ func (c curve) Inverse(k *big.Int) *big.Int {
 	// multiplication of x and y in the calculates (x × y × R^-1) mod n. RR
 	// is R×R mod n thus the Montgomery multiplication x and RR gives x×R,
 	// i.e. converts x into the Montgomery domain.
-	var rr1 = []uint64{0x901192AF7C114F20, 0x3464504ADE6FA2FA, 0x620FC84C3AFFE0D4, 0x1EB5E412A22B3D3B}
-	sm2OrdMul(table[:4], x, rr1)
+	sm2OrdMul(x, x, sm2OrdRR[:])
+	sm2OrdInverse(x)
+
+	// Multiplying by one in the Montgomery domain converts a Montgomery
+	// value out of the domain.
+	one := []uint64{1, 0, 0, 0}
+	sm2OrdMul(x, x, one)
+
+	xOut := make([]byte, 32)
+	sm2LittleToBig(xOut, x)
+	return new(big.Int).SetBytes(xOut)
+}
+
+var (
+	// sm2OrdRR is R×R mod n, with R = 2^256, which converts values into
+	// the Montgomery domain modulo n.
+	sm2OrdRR = [4]uint64{0x901192AF7C114F20, 0x3464504ADE6FA2FA, 0x620FC84C3AFFE0D4, 0x1EB5E412A22B3D3B}
+	// sm2OrdOne is one in the Montgomery domain modulo n, R mod n.
+	sm2OrdOne = [4]uint64{0xAC440BF6C62ABEDD, 0x8DFC2094DE39FAD4, 0x0000000000000000, 0x0000000100000000}
+)
+
+// sm2OrdInverse sets x, in the Montgomery domain modulo n, to its inverse
+// x^(n-2), also in the Montgomery domain. The sequence of operations only
+// depends on n, so it runs in constant time with respect to x. The inverse
+// of zero is zero.
+func sm2OrdInverse(x []uint64) {
+	// table will store precomputed powers of x. The four words at index
+	// 4×i store x^(i+1).
+	var table [4 * 15]uint64
+	copy(table[:4], x)
 
 	// Prepare the table, no need in constant time access, because the
 	// power is not a secret. (Entry 0 is never used.)
@@ -78,6 +102,8 @@ func (c curve) Inverse(k *big.Int) *big.Int {
 		sm2OrdMul(table[4*i:], table[4*(i-1):], table[:4])
 	}
 
+	// The exponent is n-2, whose upper 128 bits are
+	// FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFF.
 	x[0] = table[4*14+0]
 	x[1] = table[4*14+1]
 	x[2] = table[4*14+2]
@@ -85,114 +111,70 @@ func (c curve) Inverse(k *big.Int) *big.Int {
 
 	sm2OrdSqr(x, x, 4)
 	sm2OrdMul(x, x, table[4*14:4*14+4])
-	t := make([]uint64, 4, 4)
-	t[0] = x[0]
-	t[1] = x[1]
-	t[2] = x[2]
-	t[3] = x[3]
+	var t8 [4]uint64
+	copy(t8[:], x)
 
 	sm2OrdSqr(x, x, 8)
-	sm2OrdMul(x, x, t)
-	t[0] = x[0]
-	t[1] = x[1]
-	t[2] = x[2]
-	t[3] = x[3]
+	sm2OrdMul(x, x, t8[:])
+	var t16 [4]uint64
+	copy(t16[:], x)
 
 	sm2OrdSqr(x, x, 16)
-	sm2OrdMul(x, x, t)
-	t[0] = x[0]
-	t[1] = x[1]
-	t[2] = x[2]
-	t[3] = x[3]
-
-	sm2OrdSqr(x, x, 64)
-	sm2OrdMul(x, x, t)
-	sm2OrdSqr(x, x, 32)
-	sm2OrdMul(x, x, t)
+	sm2OrdMul(x, x, t16[:])
+	var t32 [4]uint64
+	copy(t32[:], x)
 
-	// Remaining 32 windows
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[40:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[44:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[52:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[20:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[56:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[36:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[36:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[48:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[36:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[24:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[0:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[24:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[32:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[52:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[28:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[12:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[56:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[8:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[40:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[32:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[44:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[36:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[44:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[4:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[56:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[44:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[20:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[8:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[4:])
-	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[16:])
+	// x^FFFFFFFE
+	copy(x, t16[:])
+	sm2OrdSqr(x, x, 8)
+	sm2OrdMul(x, x, t8[:])
 	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[12:])
+	sm2OrdMul(x, x, table[4*14:4*14+4])
 	sm2OrdSqr(x, x, 4)
-	sm2OrdMul(x, x, table[56:])
-
-	// Multiplying by one in the Montgomery domain converts a Montgomery
-	// value out of the domain.
-	one := []uint64{1, 0, 0, 0}
-	sm2OrdMul(x, x, one)
+	sm2OrdMul(x, x, table[4*13:4*13+4])
 
-	xOut := make([]byte, 32)
-	sm2LittleToBig(xOut, x)
-	return new(big.Int).SetBytes(xOut)
+	sm2OrdSqr(x, x, 32)
+	sm2OrdMul(x, x, t32[:])
+	sm2OrdSqr(x, x, 32)
+	sm2OrdMul(x, x, t32[:])
+	sm2OrdSqr(x, x, 32)
+	sm2OrdMul(x, x, t32[:])
+
+	// Remaining 32 windows, 7203DF6B21C6052B53BBF40939D54121
+	windows := [32]uint8{
+		0x7, 0x2, 0x0, 0x3, 0xD, 0xF, 0x6, 0xB,
+		0x2, 0x1, 0xC, 0x6, 0x0, 0x5, 0x2, 0xB,
+		0x5, 0x3, 0xB, 0xB, 0xF, 0x4, 0x0, 0x9,
+		0x3, 0x9, 0xD, 0x5, 0x4, 0x1, 0x2, 0x1,
+	}
+	for _, w := range windows {
+		sm2OrdSqr(x, x, 4)
+		if w != 0 {
+			sm2OrdMul(x, x, table[4*(w-1):4*w])
+		}
+	}
 }
 
 func (c curve) CombinedMult(bigX, bigY *big.Int, baseScalar, scalar []byte) (x, y *big.Int) {
-	scalarReversed := make([]uint64, 4)
+	r := combinedMultJacobian(bigX, bigY, baseScalar, scalar)
+	return r.pointToAffine()
+}
+
+// combinedMultJacobian returns baseScalar*G + scalar*(bigX, bigY) in
+// Jacobian coordinates, in the Montgomery domain.
+func combinedMultJacobian(bigX, bigY *big.Int, baseScalar, scalar []byte) point {
+	var s, t [4]uint64
+	p256GetScalar(s[:], baseScalar)
+	p256GetScalar(t[:], scalar)
+	return combinedMultLimbs(bigX, bigY, s[:], t[:])
+}
+
+// combinedMultLimbs is combinedMultJacobian for scalars already reduced
+// modulo n, in little-endian limbs.
+func combinedMultLimbs(bigX, bigY *big.Int, baseScalar, scalar []uint64) point {
 	var r1, r2 point
-	p256GetScalar(scalarReversed, baseScalar)
-	r1.baseMult(scalarReversed)
+	r1.baseMult(baseScalar)
 
-	p256GetScalar(scalarReversed, scalar)
 	fromBig(r2.xyz[0:4], maybeReduceModP(bigX))
 	fromBig(r2.xyz[4:8], maybeReduceModP(bigY))
 	sm2Mul(r2.xyz[0:4], r2.xyz[0:4], rr0[:])
@@ -204,9 +186,9 @@ func (c curve) CombinedMult(bigX, bigY *big.Int, baseScalar, scalar []byte) (x,
 	r2.xyz[10] = 0x0000000000000000
 	r2.xyz[11] = 0x0000000100000000
 
-	r2.scalarMult(scalarReversed)
+	r2.scalarMult(scalar)
 	sm2PointAddAsm(r1.xyz[:], r1.xyz[:], r2.xyz[:])
-	return r1.pointToAffine()
+	return r1
 }
 
 func (c curve) ScalarBaseMult(scalar []byte) (x, y *big.Int) {
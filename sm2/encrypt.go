@@ -0,0 +1,209 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+// CipherMode is the order in which the C1, C2 and C3 parts of an SM2
+// ciphertext are concatenated.
+type CipherMode int
+
+const (
+	// C1C3C2 is the order defined by GB/T 32918.4-2016.
+	C1C3C2 CipherMode = iota
+	// C1C2C3 is the order of the original GM/T 0003-2012, still used by
+	// many older implementations.
+	C1C2C3
+)
+
+// DecrypterOpts can be passed to PrivateKey.Decrypt to select the
+// ciphertext layout. A nil opts means C1C3C2.
+type DecrypterOpts struct {
+	Mode CipherMode
+}
+
+var errDecryption = errors.New("sm2 decryption error")
+
+// Encrypt encrypts msg for the public key and returns the ciphertext in the
+// C1C3C2 order. If random is nil, crypto/rand.Reader is used.
+func Encrypt(pub *ecdsa.PublicKey, msg []byte, random io.Reader) ([]byte, error) {
+	return EncryptWithMode(pub, msg, random, C1C3C2)
+}
+
+// EncryptWithMode encrypts msg for the public key and returns the ciphertext
+// in the given order. C1 is always the uncompressed point 04||x1||y1.
+func EncryptWithMode(pub *ecdsa.PublicKey, msg []byte, random io.Reader, mode CipherMode) ([]byte, error) {
+	if pub == nil {
+		return nil, errors.New("public key should not be nil")
+	}
+	if _, ok := pub.Curve.(curve); !ok {
+		return nil, errors.New("the curve type is not SM2Curve")
+	}
+	if len(msg) == 0 {
+		return nil, errors.New("message to encrypt should not be empty")
+	}
+	if mode != C1C3C2 && mode != C1C2C3 {
+		return nil, errors.New("unknown cipher mode")
+	}
+	if random == nil {
+		random = rand.Reader
+	}
+
+	for {
+		k, err := randFieldElement(pub.Curve, random)
+		if err != nil {
+			return nil, err
+		}
+		x1, y1 := pub.ScalarBaseMult(k.Bytes())
+		x2, y2 := pub.ScalarMult(pub.X, pub.Y, k.Bytes())
+
+		x2Buf, y2Buf := toBytes(x2), toBytes(y2)
+		c2, ok := kdf(len(msg), x2Buf, y2Buf)
+		if !ok {
+			continue
+		}
+		for i := range c2 {
+			c2[i] ^= msg[i]
+		}
+		c3 := hashC3(x2Buf, msg, y2Buf)
+
+		return joinCipher(marshalPoint(x1, y1, false), c2, c3, mode), nil
+	}
+}
+
+// Decrypt decrypts a ciphertext in the C1C3C2 order.
+func Decrypt(p *PrivateKey, ciphertext []byte) ([]byte, error) {
+	return DecryptWithMode(p, ciphertext, C1C3C2)
+}
+
+// DecryptWithMode decrypts a ciphertext in the given order and checks its C3
+// hash. C1 may be encoded in uncompressed, compressed or hybrid form.
+func DecryptWithMode(p *PrivateKey, ciphertext []byte, mode CipherMode) ([]byte, error) {
+	x1, y1, c2, c3, err := splitCipher(ciphertext, mode)
+	if err != nil {
+		return nil, errDecryption
+	}
+	return decrypt(p, x1, y1, c2, c3)
+}
+
+// Decrypt implements crypto.Decrypter. opts may be nil or a *DecrypterOpts.
+func (p *PrivateKey) Decrypt(_ io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	mode := C1C3C2
+	switch o := opts.(type) {
+	case nil:
+	case *DecrypterOpts:
+		if o != nil {
+			mode = o.Mode
+		}
+	default:
+		return nil, errors.New("invalid options for Decrypt")
+	}
+	return DecryptWithMode(p, ciphertext, mode)
+}
+
+// splitCipher splits a raw ciphertext in the given order into the point C1
+// and the C2 and C3 parts.
+func splitCipher(ciphertext []byte, mode CipherMode) (x1, y1 *big.Int, c2, c3 []byte, err error) {
+	x1, y1, n, err := unmarshalPoint(ciphertext)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	rest := ciphertext[n:]
+	if len(rest) <= sm3.Size {
+		return nil, nil, nil, nil, errors.New("ciphertext too short")
+	}
+
+	switch mode {
+	case C1C3C2:
+		c3, c2 = rest[:sm3.Size], rest[sm3.Size:]
+	case C1C2C3:
+		c2, c3 = rest[:len(rest)-sm3.Size], rest[len(rest)-sm3.Size:]
+	default:
+		return nil, nil, nil, nil, errors.New("unknown cipher mode")
+	}
+	return x1, y1, c2, c3, nil
+}
+
+// joinCipher concatenates an encoded C1 point with C2 and C3 in the given
+// order.
+func joinCipher(c1, c2, c3 []byte, mode CipherMode) []byte {
+	out := make([]byte, 0, len(c1)+len(c2)+len(c3))
+	out = append(out, c1...)
+	if mode == C1C2C3 {
+		return append(append(out, c2...), c3...)
+	}
+	return append(append(out, c3...), c2...)
+}
+
+// decrypt recovers the message from the parts of a ciphertext. C1 must
+// already be known to be on the curve.
+func decrypt(p *PrivateKey, x1, y1 *big.Int, c2, c3 []byte) ([]byte, error) {
+	x2, y2 := p.Curve.ScalarMult(x1, y1, p.D.Bytes())
+
+	x2Buf, y2Buf := toBytes(x2), toBytes(y2)
+	msg, ok := kdf(len(c2), x2Buf, y2Buf)
+	if !ok {
+		return nil, errDecryption
+	}
+	for i := range msg {
+		msg[i] ^= c2[i]
+	}
+
+	if subtle.ConstantTimeCompare(hashC3(x2Buf, msg, y2Buf), c3) != 1 {
+		return nil, errDecryption
+	}
+	return msg, nil
+}
+
+// hashC3 computes C3 = SM3(x2 || M || y2).
+func hashC3(x2, msg, y2 []byte) []byte {
+	h := sm3.New()
+	h.Write(x2)
+	h.Write(msg)
+	h.Write(y2)
+	return h.Sum(nil)
+}
+
+// kdf is the SM3 based key derivation function of GB/T 32918.4. It returns
+// klen bytes derived from the concatenation of z, and false if they are all
+// zero.
+func kdf(klen int, z ...[]byte) ([]byte, bool) {
+	out := make([]byte, 0, klen+sm3.Size)
+	var ct [4]byte
+	h := sm3.New()
+	for i := uint32(1); len(out) < klen; i++ {
+		binary.BigEndian.PutUint32(ct[:], i)
+		h.Reset()
+		for _, v := range z {
+			h.Write(v)
+		}
+		h.Write(ct[:])
+		out = h.Sum(out)
+	}
+	out = out[:klen]
+
+	var acc byte
+	for _, b := range out {
+		acc |= b
+	}
+	return out, acc != 0
+}
@@ -0,0 +1,138 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+// sm2Cipher is the SM2Cipher structure of GM/T 0009-2012, used by GmSSL,
+// OpenSSL and BouncyCastle among others.
+//
+//	SM2Cipher ::= SEQUENCE {
+//	    XCoordinate INTEGER,
+//	    YCoordinate INTEGER,
+//	    HASH        OCTET STRING SIZE(32),
+//	    CipherText  OCTET STRING
+//	}
+type sm2Cipher struct {
+	XCoordinate *big.Int
+	YCoordinate *big.Int
+	HASH        []byte
+	CipherText  []byte
+}
+
+// EncryptASN1 encrypts msg for the public key and returns the ciphertext as
+// a DER encoded SM2Cipher.
+func EncryptASN1(pub *ecdsa.PublicKey, msg []byte, random io.Reader) ([]byte, error) {
+	ciphertext, err := Encrypt(pub, msg, random)
+	if err != nil {
+		return nil, err
+	}
+	return CipherToASN1(ciphertext, C1C3C2)
+}
+
+// DecryptASN1 decrypts a DER encoded SM2Cipher.
+func DecryptASN1(p *PrivateKey, der []byte) ([]byte, error) {
+	x1, y1, c2, c3, err := parseCipherASN1(der)
+	if err != nil {
+		return nil, errDecryption
+	}
+	return decrypt(p, x1, y1, c2, c3)
+}
+
+// CipherToASN1 converts a raw ciphertext in the given order, with C1 in any
+// point encoding, to a DER encoded SM2Cipher.
+func CipherToASN1(ciphertext []byte, mode CipherMode) ([]byte, error) {
+	x1, y1, c2, c3, err := splitCipher(ciphertext, mode)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(sm2Cipher{x1, y1, c3, c2})
+}
+
+// ASN1ToCipher converts a DER encoded SM2Cipher to a raw ciphertext in the
+// given order, with C1 uncompressed.
+func ASN1ToCipher(der []byte, mode CipherMode) ([]byte, error) {
+	x1, y1, c2, c3, err := parseCipherASN1(der)
+	if err != nil {
+		return nil, err
+	}
+	if mode != C1C3C2 && mode != C1C2C3 {
+		return nil, errors.New("unknown cipher mode")
+	}
+	return joinCipher(marshalPoint(x1, y1, false), c2, c3, mode), nil
+}
+
+// ConvertCipherMode reorders a raw ciphertext from one order to the other,
+// keeping the encoding of C1.
+func ConvertCipherMode(ciphertext []byte, from, to CipherMode) ([]byte, error) {
+	_, _, c2, c3, err := splitCipher(ciphertext, from)
+	if err != nil {
+		return nil, err
+	}
+	if to != C1C3C2 && to != C1C2C3 {
+		return nil, errors.New("unknown cipher mode")
+	}
+	c1 := ciphertext[:len(ciphertext)-len(c2)-len(c3)]
+	return joinCipher(c1, c2, c3, to), nil
+}
+
+// CompressCipher returns a copy of a raw ciphertext, in either order, with
+// C1 in the 33 bytes compressed form.
+func CompressCipher(ciphertext []byte) ([]byte, error) {
+	return recodeC1(ciphertext, true)
+}
+
+// DecompressCipher returns a copy of a raw ciphertext, in either order, with
+// C1 in the 65 bytes uncompressed form.
+func DecompressCipher(ciphertext []byte) ([]byte, error) {
+	return recodeC1(ciphertext, false)
+}
+
+func recodeC1(ciphertext []byte, compress bool) ([]byte, error) {
+	x1, y1, n, err := unmarshalPoint(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext)-n <= sm3.Size {
+		return nil, errors.New("ciphertext too short")
+	}
+	return append(marshalPoint(x1, y1, compress), ciphertext[n:]...), nil
+}
+
+func parseCipherASN1(der []byte) (x1, y1 *big.Int, c2, c3 []byte, err error) {
+	var c sm2Cipher
+	rest, err := asn1.Unmarshal(der, &c)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, nil, nil, errors.New("trailing data after SM2Cipher")
+	}
+	if len(c.HASH) != sm3.Size || len(c.CipherText) == 0 {
+		return nil, nil, nil, nil, errors.New("invalid SM2Cipher")
+	}
+
+	P := sm2Curve.Params().P
+	if c.XCoordinate.Sign() < 0 || c.XCoordinate.Cmp(P) >= 0 ||
+		c.YCoordinate.Sign() < 0 || c.YCoordinate.Cmp(P) >= 0 ||
+		!sm2Curve.IsOnCurve(c.XCoordinate, c.YCoordinate) {
+		return nil, nil, nil, nil, errors.New("point is not on the curve")
+	}
+	return c.XCoordinate, c.YCoordinate, c.CipherText, c.HASH, nil
+}
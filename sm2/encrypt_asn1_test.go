@@ -0,0 +1,116 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Ciphertexts produced by "openssl pkeyutl -encrypt" for testKey.
+var opensslASN1Tests = []struct {
+	der string
+	msg string
+}{
+	{
+		"307b02203b05887587f0f2fb1a8431257d25565b690d1a3f4e528911115cf1304b6131610220363c92085e7aa75b4ae3a601d35bea096cfee29068f9ddbc91730e5e9227cfcb042012f2c08cbd2ffb576ecdf96b68f8dc2bd8e8e8ef8d29689e96d1877191b31eed041342fda8e99d749cb83d5f41e65c9a0070d8f440",
+		"encryption standard",
+	},
+	{
+		"3081bd022002fb4b58252cbf7e4d6603747f9401f66588d53e8d0a5d710f01fccb4f97fe5b022100b6d45cdc1bb2ecc47fd73e223307933a20a10e68ae7b7ce7f770013d11e8a6680420b3a9fe6d1b3bd4303516be6853257ee12162744745073435ccc34aaeb6639f040454303cb37a10b73d243b37594cf0ceca1a75cec81aea22e1d81d90476695da84c3b2035c31e55e47daedc7349be88705fe1794323333f8d9cfe5fb65d639abbc3a3b24f73ce2ec7db4b23543d0d6d77cffba19cb51",
+		"hello from openssl, a longer message spanning more than one SM3 block of KDF output!",
+	},
+}
+
+func TestDecryptASN1OpenSSL(t *testing.T) {
+	priKey := testKey()
+	for i, test := range opensslASN1Tests {
+		der, _ := hex.DecodeString(test.der)
+		msg, err := DecryptASN1(priKey, der)
+		if err != nil {
+			t.Fatalf("#%d: decryption error: %s", i, err)
+		}
+		if string(msg) != test.msg {
+			t.Errorf("#%d: got %q, want %q", i, msg, test.msg)
+		}
+
+		// Every conversion must decrypt to the same message and convert
+		// back to the original DER bytes.
+		for _, mode := range []CipherMode{C1C3C2, C1C2C3} {
+			raw, err := ASN1ToCipher(der, mode)
+			if err != nil {
+				t.Fatalf("#%d: ASN1ToCipher: %s", i, err)
+			}
+			compressed, err := CompressCipher(raw)
+			if err != nil {
+				t.Fatalf("#%d: CompressCipher: %s", i, err)
+			}
+			if len(compressed) != len(raw)-32 {
+				t.Errorf("#%d: compressed ciphertext has length %d", i, len(compressed))
+			}
+			for _, c := range [][]byte{raw, compressed} {
+				msg, err := DecryptWithMode(priKey, c, mode)
+				if err != nil || string(msg) != test.msg {
+					t.Errorf("#%d: mode %d: got %q, %v", i, mode, msg, err)
+				}
+				back, err := CipherToASN1(c, mode)
+				if err != nil || !bytes.Equal(back, der) {
+					t.Errorf("#%d: mode %d: CipherToASN1 = %x, %v", i, mode, back, err)
+				}
+			}
+			decompressed, err := DecompressCipher(compressed)
+			if err != nil || !bytes.Equal(decompressed, raw) {
+				t.Errorf("#%d: DecompressCipher = %x, %v", i, decompressed, err)
+			}
+		}
+	}
+}
+
+func TestEncryptASN1(t *testing.T) {
+	priKey, _ := GenerateKey()
+	msg := []byte("test message 123012301230")
+	der, err := EncryptASN1(&priKey.PublicKey, msg, nil)
+	if err != nil {
+		t.Fatalf("encryption error: %s", err)
+	}
+	plain, err := DecryptASN1(priKey, der)
+	if err != nil || !bytes.Equal(plain, msg) {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+
+	if _, err := DecryptASN1(priKey, append(der, 0)); err == nil {
+		t.Error("SM2Cipher with trailing data decrypted")
+	}
+	if _, err := DecryptASN1(priKey, der[:len(der)-1]); err == nil {
+		t.Error("truncated SM2Cipher decrypted")
+	}
+}
+
+func TestConvertCipherMode(t *testing.T) {
+	priKey, _ := GenerateKey()
+	msg := []byte("test message 123012301230")
+	c1c3c2, _ := Encrypt(&priKey.PublicKey, msg, nil)
+	c1c3c2, _ = CompressCipher(c1c3c2)
+
+	c1c2c3, err := ConvertCipherMode(c1c3c2, C1C3C2, C1C2C3)
+	if err != nil {
+		t.Fatalf("ConvertCipherMode: %s", err)
+	}
+	plain, err := DecryptWithMode(priKey, c1c2c3, C1C2C3)
+	if err != nil || !bytes.Equal(plain, msg) {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	back, _ := ConvertCipherMode(c1c2c3, C1C2C3, C1C3C2)
+	if !bytes.Equal(back, c1c3c2) {
+		t.Errorf("round trip gave %x, want %x", back, c1c3c2)
+	}
+}
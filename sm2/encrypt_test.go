@@ -0,0 +1,133 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+var _ crypto.Decrypter = (*PrivateKey)(nil)
+
+// testKey is an SM2 key generated with OpenSSL 3.0, "openssl genpkey -algorithm SM2".
+func testKey() *PrivateKey {
+	d, _ := new(big.Int).SetString("db3829f6530ae7db3188e7b88b9455b14ccd4f938311245b0e36cd8e857ec5c4", 16)
+	x, y := sm2Curve.ScalarBaseMult(d.Bytes())
+	return &PrivateKey{
+		PrivateKey: &ecdsa.PrivateKey{
+			D:         d,
+			PublicKey: ecdsa.PublicKey{X: x, Y: y, Curve: sm2Curve},
+		},
+	}
+}
+
+// opensslCiphertext is "encryption standard" encrypted to testKey by
+// "openssl pkeyutl -encrypt", converted from ASN.1 to C1C3C2.
+const opensslCiphertext = "04" +
+	"3b05887587f0f2fb1a8431257d25565b690d1a3f4e528911115cf1304b613161" +
+	"363c92085e7aa75b4ae3a601d35bea096cfee29068f9ddbc91730e5e9227cfcb" +
+	"12f2c08cbd2ffb576ecdf96b68f8dc2bd8e8e8ef8d29689e96d1877191b31eed" +
+	"42fda8e99d749cb83d5f41e65c9a0070d8f440"
+
+func TestDecryptOpenSSL(t *testing.T) {
+	ciphertext, _ := hex.DecodeString(opensslCiphertext)
+	msg, err := Decrypt(testKey(), ciphertext)
+	if err != nil {
+		t.Fatalf("decryption error: %s", err)
+	}
+	if string(msg) != "encryption standard" {
+		t.Errorf("got %q", msg)
+	}
+}
+
+func TestEncryptAndDecrypt(t *testing.T) {
+	priKey, _ := GenerateKey()
+	for _, msg := range [][]byte{
+		[]byte("a"),
+		[]byte("test message 123012301230"),
+		bytes.Repeat([]byte("0123456789"), 100),
+	} {
+		for _, mode := range []CipherMode{C1C3C2, C1C2C3} {
+			ciphertext, err := EncryptWithMode(&priKey.PublicKey, msg, rand.Reader, mode)
+			if err != nil {
+				t.Fatalf("encryption error: %s", err)
+			}
+			if len(ciphertext) != 1+64+32+len(msg) {
+				t.Errorf("unexpected ciphertext length %d", len(ciphertext))
+			}
+
+			plain, err := priKey.Decrypt(nil, ciphertext, &DecrypterOpts{Mode: mode})
+			if err != nil {
+				t.Fatalf("decryption error: %s", err)
+			}
+			if !bytes.Equal(plain, msg) {
+				t.Errorf("mode %d: got %x, want %x", mode, plain, msg)
+			}
+
+			other := C1C2C3 - mode
+			if _, err := DecryptWithMode(priKey, ciphertext, other); err == nil {
+				t.Errorf("mode %d: ciphertext decrypted in mode %d", mode, other)
+			}
+
+			ciphertext[len(ciphertext)-1] ^= 1
+			if _, err := DecryptWithMode(priKey, ciphertext, mode); err == nil {
+				t.Errorf("mode %d: tampered ciphertext decrypted", mode)
+			}
+		}
+	}
+}
+
+func TestDecryptInvalid(t *testing.T) {
+	priKey, _ := GenerateKey()
+	ciphertext, err := Encrypt(&priKey.PublicKey, []byte("abc"), nil)
+	if err != nil {
+		t.Fatalf("encryption error: %s", err)
+	}
+
+	// C1 not on the curve
+	bad := append([]byte{}, ciphertext...)
+	bad[64] ^= 1
+	if _, err := Decrypt(priKey, bad); err == nil {
+		t.Error("ciphertext with invalid C1 decrypted")
+	}
+	if _, err := Decrypt(priKey, ciphertext[:97]); err == nil {
+		t.Error("truncated ciphertext decrypted")
+	}
+	if _, err := Encrypt(&priKey.PublicKey, nil, nil); err == nil {
+		t.Error("empty message encrypted")
+	}
+}
+
+func BenchmarkSM2Encrypt(b *testing.B) {
+	msg := make([]byte, 256)
+	priKey, _ := GenerateKey()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Encrypt(&priKey.PublicKey, msg, rand.Reader)
+	}
+}
+
+func BenchmarkSM2Decrypt(b *testing.B) {
+	msg := make([]byte, 256)
+	priKey, _ := GenerateKey()
+	ciphertext, _ := Encrypt(&priKey.PublicKey, msg, rand.Reader)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Decrypt(priKey, ciphertext)
+	}
+}
@@ -15,27 +15,153 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"encoding/asn1"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
+
+	"github.com/rongzer/gm/sm3"
 )
 
 type PrivateKey struct {
 	*ecdsa.PrivateKey
 }
 
+// PublicKey is an SM2 public key.
+type PublicKey struct {
+	*ecdsa.PublicKey
+}
+
 type sm2Signature struct {
 	R, S *big.Int
 }
 
-func (p *PrivateKey) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
-	r, s, err := Sign(p, digest)
+// SignerOpts can be passed to PrivateKey.Sign to choose what is signed.
+//
+// A zero SignerOpts signs with DefaultID. Any opts that are not a non-nil
+// *SignerOpts, including nil and crypto.Hash(0), sign with LegacyID like the
+// Sign function, as PrivateKey.Sign did before SignerOpts existed.
+type SignerOpts struct {
+	// UID is the signer ID hashed into Z. If it is nil, DefaultID is used.
+	UID []byte
+	// Digest reports that the input of Sign is not the message but the
+	// precomputed e = SM3(Z || M), as returned by CalculateDigest. UID is
+	// ignored in that case.
+	Digest bool
+	// Deterministic derives the nonce from the private key and the digest
+	// only, as SignDigestDeterministic does, instead of using the random
+	// source passed to Sign.
+	Deterministic bool
+}
+
+// HashFunc implements crypto.SignerOpts. SM2 hashes the message itself, so
+// it returns zero.
+func (o *SignerOpts) HashFunc() crypto.Hash {
+	return 0
+}
+
+// Public returns the public key as a *PublicKey. Unlike the method of the
+// embedded *ecdsa.PrivateKey it overrides, it does not return an
+// *ecdsa.PublicKey; use &p.PublicKey where one is needed.
+func (p *PrivateKey) Public() crypto.PublicKey {
+	return &PublicKey{PublicKey: &p.PublicKey}
+}
+
+// Sign implements crypto.Signer and returns an ASN.1 encoded signature. The
+// nonce uses entropy from random, or from crypto/rand.Reader if it is nil,
+// unless opts is a *SignerOpts with Deterministic set.
+//
+// What is signed depends on opts:
+//   - a non-nil *SignerOpts signs the raw message with its UID, DefaultID if
+//     UID is nil, or the precomputed e = SM3(Z || M) if Digest is set;
+//   - nil, a nil *SignerOpts and other opts with a zero HashFunc, such as
+//     crypto.Hash(0), sign the raw message with LegacyID, as Sign does.
+//
+// Other SM2 implementations such as OpenSSL and GmSSL expect DefaultID, so
+// pass &SignerOpts{} to interoperate with them.
+//
+// Other opts with a non-zero HashFunc are rejected: SM2 only signs SM3
+// digests, which crypto.Hash cannot name, so a precomputed e must be passed
+// with a *SignerOpts that has Digest set.
+func (p *PrivateKey) Sign(random io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	digest, err := digestWithOpts(&p.PublicKey, msg, opts)
+	if err != nil {
+		return nil, err
+	}
+	var r, s *big.Int
+	if o, ok := opts.(*SignerOpts); ok && o != nil && o.Deterministic {
+		r, s, err = SignDigestDeterministic(p, digest)
+	} else {
+		r, s, err = SignDigest(p, digest, random)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return MarshalSignature(r, s)
+}
 
-	return asn1.Marshal(sm2Signature{r, s})
+// Verify checks whether the input (r, s) is a valid signature for msg, with
+// opts interpreted as by PrivateKey.Sign: nil opts and crypto.Hash(0) check
+// a signature made with LegacyID, &SignerOpts{} one made with DefaultID.
+func (pub *PublicKey) Verify(msg []byte, r, s *big.Int, opts crypto.SignerOpts) bool {
+	digest, err := digestWithOpts(pub.PublicKey, msg, opts)
+	if err != nil {
+		return false
+	}
+	return VerifyDigest(pub.PublicKey, digest, r, s)
+}
+
+// VerifyASN1 checks whether sig is a valid ASN.1 encoded signature for msg,
+// as returned by PrivateKey.Sign with the same opts. As for Verify, nil opts
+// and crypto.Hash(0) mean LegacyID and &SignerOpts{} means DefaultID.
+func (pub *PublicKey) VerifyASN1(msg, sig []byte, opts crypto.SignerOpts) bool {
+	r, s, err := UnmarshalSignature(sig)
+	if err != nil {
+		return false
+	}
+	return pub.Verify(msg, r, s, opts)
+}
+
+// Equal reports whether pub and x have the same value. x may be a
+// *PublicKey or an *ecdsa.PublicKey.
+func (pub *PublicKey) Equal(x crypto.PublicKey) bool {
+	var xx *ecdsa.PublicKey
+	switch k := x.(type) {
+	case *PublicKey:
+		xx = k.PublicKey
+	case *ecdsa.PublicKey:
+		xx = k
+	}
+	if xx == nil || pub == nil || pub.PublicKey == nil ||
+		xx.X == nil || xx.Y == nil || pub.X == nil || pub.Y == nil {
+		return false
+	}
+	// curve is not comparable, compare the parameters instead.
+	return pub.X.Cmp(xx.X) == 0 && pub.Y.Cmp(xx.Y) == 0 &&
+		pub.Params() == xx.Params()
+}
+
+// digestWithOpts returns the e = SM3(Z || M) to sign or verify for the
+// input of PrivateKey.Sign.
+func digestWithOpts(pub *ecdsa.PublicKey, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	o, _ := opts.(*SignerOpts)
+	if o == nil {
+		if opts != nil && opts.HashFunc() != 0 {
+			return nil, errors.New("only SM3 digests can be signed, use SignerOpts with Digest set")
+		}
+		return legacyDigest(pub, msg)
+	}
+	if o.Digest {
+		if len(msg) != sm3.Size {
+			return nil, errors.New("the digest should be 32 bytes")
+		}
+		return msg, nil
+	}
+	uid := o.UID
+	if uid == nil {
+		uid = DefaultID
+	}
+	return CalculateDigest(pub, msg, uid)
 }
 
 func GenerateKey() (*PrivateKey, error) {
@@ -54,3 +180,29 @@ func GenerateKey() (*PrivateKey, error) {
 		},
 	}, nil
 }
+
+// NewPrivateKey returns the private key with the big-endian scalar d, which
+// must be in [1, n-2].
+func NewPrivateKey(d []byte) (*PrivateKey, error) {
+	k := new(big.Int).SetBytes(d)
+	nMinus1 := new(big.Int).Sub(sm2Curve.Params().N, one)
+	if k.Sign() <= 0 || k.Cmp(nMinus1) >= 0 {
+		return nil, errors.New("invalid private key")
+	}
+	x, y := sm2Curve.ScalarBaseMult(toBytes(k))
+	return &PrivateKey{
+		PrivateKey: &ecdsa.PrivateKey{
+			D: k,
+			PublicKey: ecdsa.PublicKey{
+				X:     x,
+				Y:     y,
+				Curve: sm2Curve,
+			},
+		},
+	}, nil
+}
+
+// Curve returns the sm2p256v1 curve of the SM2 keys.
+func Curve() elliptic.Curve {
+	return sm2Curve
+}
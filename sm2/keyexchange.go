@@ -0,0 +1,235 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+// KeyExchange holds the state of one party of the SM2 key exchange protocol
+// of GB/T 32918.3. The messages flow as follows:
+//
+//	initiator                              responder
+//	rA := Init()               ---rA--->
+//	                           <--rB,sB--  rB, sB, key := Respond(rA)
+//	key, sA := Confirm(rB, sB) ---sA--->
+//	                                       ConfirmInitiator(sA)
+//
+// sB and sA are the optional confirmation hashes S_B and S_A. A responder
+// that does not need key confirmation can ignore sA, and an initiator passes
+// a nil sB to Confirm when the responder did not send one.
+type KeyExchange struct {
+	initiator bool
+	keyLen    int
+	priv      *PrivateKey
+	peerPub   *ecdsa.PublicKey
+	// Z values of the initiator and of the responder
+	za, zb []byte
+
+	// ephemeral key pair and the peer's ephemeral public key
+	r            *big.Int
+	rx, ry       *big.Int
+	peerX, peerY *big.Int
+
+	// the shared point U or V, nil until the exchange completed
+	sx, sy *big.Int
+	key    []byte
+}
+
+// NewKeyExchange creates the state for one party of a key exchange, using its
+// long-term private key and ID and the long-term public key and ID of the
+// other party. keyLen is the length in bytes of the agreed key.
+func NewKeyExchange(priv *PrivateKey, peerPub *ecdsa.PublicKey, id, peerID []byte, keyLen int, initiator bool) (*KeyExchange, error) {
+	if priv == nil {
+		return nil, errors.New("private key should not be nil")
+	}
+	if keyLen <= 0 {
+		return nil, errors.New("the key length should be positive")
+	}
+	if peerPub == nil || peerPub.X == nil || peerPub.Y == nil ||
+		!sm2Curve.IsOnCurve(peerPub.X, peerPub.Y) {
+		return nil, errors.New("invalid peer public key")
+	}
+
+	h := sm3.New()
+	z, err := computeZ(id, &priv.PublicKey, h)
+	if err != nil {
+		return nil, err
+	}
+	peerZ, err := computeZ(peerID, peerPub, h)
+	if err != nil {
+		return nil, err
+	}
+
+	ke := &KeyExchange{
+		initiator: initiator,
+		keyLen:    keyLen,
+		priv:      priv,
+		peerPub:   peerPub,
+	}
+	if initiator {
+		ke.za, ke.zb = z, peerZ
+	} else {
+		ke.za, ke.zb = peerZ, z
+	}
+	return ke, nil
+}
+
+// Init generates the initiator's ephemeral key and returns R_A, to be sent to
+// the responder. If random is nil, crypto/rand.Reader is used.
+func (ke *KeyExchange) Init(random io.Reader) (*ecdsa.PublicKey, error) {
+	if !ke.initiator || ke.r != nil {
+		return nil, errors.New("Init must be called once by the initiator")
+	}
+	if err := ke.generateEphemeral(random); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: sm2Curve, X: ke.rx, Y: ke.ry}, nil
+}
+
+// Respond processes the initiator's R_A. It returns R_B and the confirmation
+// hash S_B, both to be sent to the initiator, and the agreed key.
+func (ke *KeyExchange) Respond(random io.Reader, ra *ecdsa.PublicKey) (rb *ecdsa.PublicKey, sb []byte, key []byte, err error) {
+	if ke.initiator || ke.r != nil {
+		return nil, nil, nil, errors.New("Respond must be called once by the responder")
+	}
+	if err = ke.generateEphemeral(random); err != nil {
+		return nil, nil, nil, err
+	}
+	if err = ke.agree(ra); err != nil {
+		return nil, nil, nil, err
+	}
+	rb = &ecdsa.PublicKey{Curve: sm2Curve, X: ke.rx, Y: ke.ry}
+	return rb, ke.confirmation(0x02), ke.key, nil
+}
+
+// Confirm processes the responder's R_B and checks S_B unless it is nil. It
+// returns the agreed key and the confirmation hash S_A for the responder.
+func (ke *KeyExchange) Confirm(rb *ecdsa.PublicKey, sb []byte) (key []byte, sa []byte, err error) {
+	if !ke.initiator || ke.r == nil || ke.key != nil {
+		return nil, nil, errors.New("Confirm must be called once by the initiator after Init")
+	}
+	if err = ke.agree(rb); err != nil {
+		return nil, nil, err
+	}
+	if sb != nil && subtle.ConstantTimeCompare(ke.confirmation(0x02), sb) != 1 {
+		ke.key = nil
+		return nil, nil, errors.New("key confirmation of the responder failed")
+	}
+	return ke.key, ke.confirmation(0x03), nil
+}
+
+// ConfirmInitiator checks the initiator's confirmation hash S_A.
+func (ke *KeyExchange) ConfirmInitiator(sa []byte) error {
+	if ke.initiator || ke.key == nil {
+		return errors.New("ConfirmInitiator must be called by the responder after Respond")
+	}
+	if subtle.ConstantTimeCompare(ke.confirmation(0x03), sa) != 1 {
+		return errors.New("key confirmation of the initiator failed")
+	}
+	return nil
+}
+
+// Key returns the agreed key, or nil if the exchange has not completed.
+func (ke *KeyExchange) Key() []byte {
+	return ke.key
+}
+
+func (ke *KeyExchange) generateEphemeral(random io.Reader) error {
+	if random == nil {
+		random = rand.Reader
+	}
+	r, err := randFieldElement(sm2Curve, random)
+	if err != nil {
+		return err
+	}
+	ke.r = r
+	ke.rx, ke.ry = sm2Curve.ScalarBaseMult(r.Bytes())
+	return nil
+}
+
+// agree computes the shared point
+//
+//	[t](P + [x̄]R), with t = (d + x̄own·r) mod n
+//
+// from the peer's long-term key P and ephemeral key R, and derives the key.
+func (ke *KeyExchange) agree(peer *ecdsa.PublicKey) error {
+	if peer == nil || peer.X == nil || peer.Y == nil ||
+		peer.X.Sign() < 0 || peer.Y.Sign() < 0 ||
+		peer.X.Cmp(sm2Curve.P) >= 0 || peer.Y.Cmp(sm2Curve.P) >= 0 ||
+		!sm2Curve.IsOnCurve(peer.X, peer.Y) {
+		return errors.New("invalid ephemeral public key")
+	}
+	ke.peerX, ke.peerY = peer.X, peer.Y
+
+	N := sm2Curve.N
+	t := reduceX(ke.rx)
+	t.Mul(t, ke.r)
+	t.Add(t, ke.priv.D)
+	t.Mod(t, N)
+
+	x, y := sm2Curve.ScalarMult(peer.X, peer.Y, reduceX(peer.X).Bytes())
+	x, y = sm2Curve.Add(ke.peerPub.X, ke.peerPub.Y, x, y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return errors.New("the shared point is at infinity")
+	}
+	x, y = sm2Curve.ScalarMult(x, y, t.Bytes())
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return errors.New("the shared point is at infinity")
+	}
+	ke.sx, ke.sy = x, y
+
+	key, _ := kdf(ke.keyLen, toBytes(x), toBytes(y), ke.za, ke.zb)
+	ke.key = key
+	return nil
+}
+
+// confirmation computes the hash S = SM3(prefix || y || SM3(x || ZA || ZB ||
+// x1 || y1 || x2 || y2)) over the shared point, where (x1, y1) is R_A and
+// (x2, y2) is R_B.
+func (ke *KeyExchange) confirmation(prefix byte) []byte {
+	x1, y1, x2, y2 := ke.rx, ke.ry, ke.peerX, ke.peerY
+	if !ke.initiator {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+
+	h := sm3.New()
+	h.Write(toBytes(ke.sx))
+	h.Write(ke.za)
+	h.Write(ke.zb)
+	h.Write(toBytes(x1))
+	h.Write(toBytes(y1))
+	h.Write(toBytes(x2))
+	h.Write(toBytes(y2))
+	inner := h.Sum(nil)
+
+	h.Reset()
+	h.Write([]byte{prefix})
+	h.Write(toBytes(ke.sy))
+	h.Write(inner)
+	return h.Sum(nil)
+}
+
+// reduceX returns x̄ = 2^w + (x & (2^w - 1)) with w = 127.
+func reduceX(x *big.Int) *big.Int {
+	const w = 127
+	mask := new(big.Int).Lsh(one, w)
+	out := new(big.Int).Sub(mask, one)
+	out.And(out, x)
+	return out.Add(out, mask)
+}
@@ -0,0 +1,205 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+var (
+	idA = []byte("ALICE123@YAHOO.COM")
+	idB = []byte("BILL456@YAHOO.COM")
+)
+
+func newKeyExchangePair(t *testing.T, keyLen int) (a, b *KeyExchange) {
+	priA, _ := GenerateKey()
+	priB, _ := GenerateKey()
+	a, err := NewKeyExchange(priA, &priB.PublicKey, idA, idB, keyLen, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = NewKeyExchange(priB, &priA.PublicKey, idB, idA, keyLen, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func TestKeyExchange(t *testing.T) {
+	for _, keyLen := range []int{1, 16, 32, 48, 100} {
+		a, b := newKeyExchangePair(t, keyLen)
+
+		ra, err := a.Init(rand.Reader)
+		if err != nil {
+			t.Fatalf("Init: %s", err)
+		}
+		rb, sb, keyB, err := b.Respond(rand.Reader, ra)
+		if err != nil {
+			t.Fatalf("Respond: %s", err)
+		}
+		keyA, sa, err := a.Confirm(rb, sb)
+		if err != nil {
+			t.Fatalf("Confirm: %s", err)
+		}
+		if err := b.ConfirmInitiator(sa); err != nil {
+			t.Fatalf("ConfirmInitiator: %s", err)
+		}
+
+		if len(keyA) != keyLen || !bytes.Equal(keyA, keyB) {
+			t.Fatalf("keys differ: %x and %x", keyA, keyB)
+		}
+		if !bytes.Equal(a.Key(), keyA) || !bytes.Equal(b.Key(), keyB) {
+			t.Error("Key does not return the agreed key")
+		}
+	}
+}
+
+// The key exchange example of GB/T 32918.5 over the recommended curve, with
+// the default ID for both parties and a 128-bit key.
+func TestKeyExchangeVector(t *testing.T) {
+	const (
+		dA  = "81eb26e941bb5af16df116495f90695272ae2cd63d6c4ae1678418be48230029"
+		dB  = "785129917d45a9ea5437a59356b82338eaadda6ceb199088f14ae10defa229b5"
+		rA  = "d4de15474db74d06491c440d305e012400990f3e390c7e87153c12db2ea60bb3"
+		rB  = "7e07124814b309489125eaed101113164ebf0f3458c5bd88335c1f9d596243d6"
+		key = "6c89347354de2484c60b4ab1fde4c6e5"
+		s1  = "d3a0fe15dee185ceae907a6b595cc32a266ed7b3367e9983a896dc32fa20f8eb"
+		s2  = "18c7894b3816df16cf07b05c5ec0bef5d655d58f779cc1b400a4f3884644db88"
+	)
+	priA, _ := NewPrivateKey(decodeHex(dA))
+	priB, _ := NewPrivateKey(decodeHex(dB))
+	a, err := NewKeyExchange(priA, &priB.PublicKey, DefaultID, DefaultID, 16, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKeyExchange(priB, &priA.PublicKey, DefaultID, DefaultID, 16, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ra, err := a.Init(scalarReader(rA))
+	if err != nil {
+		t.Fatalf("Init: %s", err)
+	}
+	rb, sb, keyB, err := b.Respond(scalarReader(rB), ra)
+	if err != nil {
+		t.Fatalf("Respond: %s", err)
+	}
+	keyA, sa, err := a.Confirm(rb, sb)
+	if err != nil {
+		t.Fatalf("Confirm: %s", err)
+	}
+	if err := b.ConfirmInitiator(sa); err != nil {
+		t.Fatalf("ConfirmInitiator: %s", err)
+	}
+
+	if got := hex.EncodeToString(keyA); got != key {
+		t.Errorf("initiator key %s, want %s", got, key)
+	}
+	if got := hex.EncodeToString(keyB); got != key {
+		t.Errorf("responder key %s, want %s", got, key)
+	}
+	if got := hex.EncodeToString(sb); got != s1 {
+		t.Errorf("S1 = %s, want %s", got, s1)
+	}
+	if got := hex.EncodeToString(sa); got != s2 {
+		t.Errorf("S2 = %s, want %s", got, s2)
+	}
+}
+
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// scalarReader returns a random source from which randFieldElement draws the
+// scalar k, 0 < k < n-1.
+func scalarReader(k string) *bytes.Reader {
+	b := make([]byte, 40)
+	km1 := new(big.Int).Sub(new(big.Int).SetBytes(decodeHex(k)), one).Bytes()
+	copy(b[len(b)-len(km1):], km1)
+	return bytes.NewReader(b)
+}
+
+func TestKeyExchangeWithoutConfirmation(t *testing.T) {
+	a, b := newKeyExchangePair(t, 16)
+	ra, _ := a.Init(nil)
+	rb, _, keyB, err := b.Respond(nil, ra)
+	if err != nil {
+		t.Fatalf("Respond: %s", err)
+	}
+	keyA, _, err := a.Confirm(rb, nil)
+	if err != nil {
+		t.Fatalf("Confirm: %s", err)
+	}
+	if !bytes.Equal(keyA, keyB) {
+		t.Fatalf("keys differ: %x and %x", keyA, keyB)
+	}
+}
+
+func TestKeyExchangeFailures(t *testing.T) {
+	a, b := newKeyExchangePair(t, 16)
+	ra, _ := a.Init(nil)
+	rb, sb, _, _ := b.Respond(nil, ra)
+
+	badSB := append([]byte{}, sb...)
+	badSB[0] ^= 1
+	if _, _, err := a.Confirm(rb, badSB); err == nil {
+		t.Error("Confirm accepted a wrong S_B")
+	}
+	if b.ConfirmInitiator(sb) == nil {
+		t.Error("ConfirmInitiator accepted S_B as S_A")
+	}
+
+	// The responder sees a different initiator ID.
+	priA, _ := GenerateKey()
+	priB, _ := GenerateKey()
+	a, _ = NewKeyExchange(priA, &priB.PublicKey, idA, idB, 16, true)
+	b, _ = NewKeyExchange(priB, &priA.PublicKey, idB, []byte("MALLORY"), 16, false)
+	ra, _ = a.Init(nil)
+	rb, sb, _, _ = b.Respond(nil, ra)
+	if _, _, err := a.Confirm(rb, sb); err == nil {
+		t.Error("Confirm accepted mismatched IDs")
+	}
+
+	// An ephemeral key that is not on the curve.
+	a, b = newKeyExchangePair(t, 16)
+	ra, _ = a.Init(nil)
+	bad := &ecdsa.PublicKey{Curve: ra.Curve, X: ra.X, Y: new(big.Int).Add(ra.Y, one)}
+	if _, _, _, err := b.Respond(nil, bad); err == nil {
+		t.Error("Respond accepted a point not on the curve")
+	}
+
+	// A peer public key without coordinates.
+	if _, err := NewKeyExchange(priA, &ecdsa.PublicKey{Curve: sm2Curve}, idA, idB, 16, true); err == nil {
+		t.Error("NewKeyExchange accepted a public key with nil coordinates")
+	}
+
+	// Calls out of order.
+	a, b = newKeyExchangePair(t, 16)
+	if _, _, err := a.Confirm(rb, nil); err == nil {
+		t.Error("Confirm before Init succeeded")
+	}
+	if _, err := b.Init(nil); err == nil {
+		t.Error("Init by the responder succeeded")
+	}
+	if err := b.ConfirmInitiator(sb); err == nil {
+		t.Error("ConfirmInitiator before Respond succeeded")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+)
+
+// Marshal encodes a point of the SM2 curve in the 65 bytes uncompressed
+// form 04 || x || y.
+func Marshal(x, y *big.Int) []byte {
+	return marshalPoint(x, y, false)
+}
+
+// MarshalCompressed encodes a point of the SM2 curve in the 33 bytes
+// compressed form 02 || x or 03 || x, depending on the parity of y.
+func MarshalCompressed(x, y *big.Int) []byte {
+	return marshalPoint(x, y, true)
+}
+
+// Unmarshal decodes a point in the uncompressed form of Marshal or in the
+// hybrid form 06 || x || y or 07 || x || y. It returns nil if data is not
+// such an encoding of a point on the curve.
+func Unmarshal(data []byte) (x, y *big.Int) {
+	if len(data) != 65 {
+		return nil, nil
+	}
+	x, y, _, err := unmarshalPoint(data)
+	if err != nil {
+		return nil, nil
+	}
+	return x, y
+}
+
+// UnmarshalCompressed decodes a point in the compressed form of
+// MarshalCompressed. It returns nil if data is not such an encoding of a
+// point on the curve.
+func UnmarshalCompressed(data []byte) (x, y *big.Int) {
+	if len(data) != 33 {
+		return nil, nil
+	}
+	x, y, _, err := unmarshalPoint(data)
+	if err != nil {
+		return nil, nil
+	}
+	return x, y
+}
+
+// ParsePublicKey decodes a public key in the uncompressed, compressed or
+// hybrid form.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	x, y, n, err := unmarshalPoint(data)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, errors.New("invalid point encoding")
+	}
+	return &PublicKey{
+		PublicKey: &ecdsa.PublicKey{Curve: sm2Curve, X: x, Y: y},
+	}, nil
+}
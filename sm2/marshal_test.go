@@ -0,0 +1,134 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// The public key of testKey in the compressed and hybrid forms, as written
+// by "openssl ec -conv_form".
+const (
+	opensslCompressed = "03b6ea18fdafff82ba26fa0326d26c13f4e962479c9978fee9d9dd094fc162b422"
+	opensslHybrid     = "07b6ea18fdafff82ba26fa0326d26c13f4e962479c9978fee9d9dd094fc162b422" +
+		"2f8f617969b21e60ce7e0c8415eb30a2de8b838c342c3918b8285e6d5291babb"
+)
+
+func TestMarshalOpenSSL(t *testing.T) {
+	pub := testKey().PublicKey
+	if got := hex.EncodeToString(MarshalCompressed(pub.X, pub.Y)); got != opensslCompressed {
+		t.Errorf("MarshalCompressed = %s", got)
+	}
+
+	compressed, _ := hex.DecodeString(opensslCompressed)
+	x, y := UnmarshalCompressed(compressed)
+	if x == nil || x.Cmp(pub.X) != 0 || y.Cmp(pub.Y) != 0 {
+		t.Errorf("UnmarshalCompressed = (%x, %x)", x, y)
+	}
+	hybrid, _ := hex.DecodeString(opensslHybrid)
+	x, y = Unmarshal(hybrid)
+	if x == nil || x.Cmp(pub.X) != 0 || y.Cmp(pub.Y) != 0 {
+		t.Errorf("Unmarshal(hybrid) = (%x, %x)", x, y)
+	}
+
+	for _, data := range [][]byte{compressed, hybrid, Marshal(pub.X, pub.Y)} {
+		key, err := ParsePublicKey(data)
+		if err != nil || !key.Equal(&pub) {
+			t.Errorf("ParsePublicKey(%x) = %v", data, err)
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for i := 0; i < 64; i++ {
+		priKey, _ := GenerateKey()
+		pub := priKey.PublicKey
+
+		compressed := MarshalCompressed(pub.X, pub.Y)
+		x, y := UnmarshalCompressed(compressed)
+		if x == nil || x.Cmp(pub.X) != 0 || y.Cmp(pub.Y) != 0 {
+			t.Fatalf("compressed round trip failed for %x", compressed)
+		}
+
+		uncompressed := Marshal(pub.X, pub.Y)
+		x, y = Unmarshal(uncompressed)
+		if x == nil || x.Cmp(pub.X) != 0 || y.Cmp(pub.Y) != 0 {
+			t.Fatalf("uncompressed round trip failed for %x", uncompressed)
+		}
+		if x, _ := Unmarshal(compressed); x != nil {
+			t.Error("Unmarshal accepted a compressed point")
+		}
+		if x, _ := UnmarshalCompressed(uncompressed); x != nil {
+			t.Error("UnmarshalCompressed accepted an uncompressed point")
+		}
+
+		// A hybrid encoding with the wrong parity of y.
+		hybrid := append([]byte{}, uncompressed...)
+		hybrid[0] = byte(7 - pub.Y.Bit(0))
+		if x, _ := Unmarshal(hybrid); x != nil {
+			t.Errorf("Unmarshal accepted %x", hybrid)
+		}
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	pub := testKey().PublicKey
+	uncompressed := Marshal(pub.X, pub.Y)
+
+	offCurve := append([]byte{}, uncompressed...)
+	offCurve[64] ^= 1
+	if x, _ := Unmarshal(offCurve); x != nil {
+		t.Error("Unmarshal accepted a point not on the curve")
+	}
+
+	// x = P is out of range, and x = 2 gives no point on the curve.
+	bigX := append([]byte{2}, toBytes(sm2Curve.P)...)
+	noPoint := append([]byte{2}, toBytes(big.NewInt(2))...)
+	for _, data := range [][]byte{bigX, noPoint, {}, {0}, uncompressed[:64], append(uncompressed, 0)} {
+		if x, _ := UnmarshalCompressed(data); x != nil {
+			t.Errorf("UnmarshalCompressed accepted %x", data)
+		}
+		if _, err := ParsePublicKey(data); err == nil {
+			t.Errorf("ParsePublicKey accepted %x", data)
+		}
+	}
+}
+
+func TestSqrt(t *testing.T) {
+	P := sm2Curve.Params().P
+	for i := 0; i < 256; i++ {
+		a, _ := rand.Int(rand.Reader, P)
+		want := new(big.Int).ModSqrt(a, P)
+		got := sqrtModP(a)
+		if (got == nil) != (want == nil) {
+			t.Fatalf("sqrt(%x) = %v, want %v", a, got, want)
+		}
+		if got != nil && got.Cmp(want) != 0 && new(big.Int).Add(got, want).Cmp(P) != 0 {
+			t.Fatalf("sqrt(%x) = %x, want ±%x", a, got, want)
+		}
+	}
+	if got := sqrtModP(new(big.Int)); got == nil || got.Sign() != 0 {
+		t.Errorf("sqrt(0) = %v", got)
+	}
+}
+
+func BenchmarkUnmarshalCompressed(b *testing.B) {
+	pub := testKey().PublicKey
+	data := MarshalCompressed(pub.X, pub.Y)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		UnmarshalCompressed(data)
+	}
+}
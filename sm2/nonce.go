@@ -0,0 +1,143 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/rand"
+	"hash"
+	"io"
+	"math/big"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+// nonceGenerator generates the nonces of RFC 6979 section 3.2 with HMAC-SM3.
+// As qlen and hlen are both 256, with x the 32 bytes private key, h1 the
+// 32 bytes digest e and k' the optional additional data of section 3.6:
+//
+//	V = 0x01 * 32, K = 0x00 * 32
+//	K = HMAC_K(V || 0x00 || x || int2octets(h1 mod n) || k'), V = HMAC_K(V)
+//	K = HMAC_K(V || 0x01 || x || int2octets(h1 mod n) || k'), V = HMAC_K(V)
+//	loop: V = HMAC_K(V), k = V if 1 <= k < n
+//	      otherwise K = HMAC_K(V || 0x00), V = HMAC_K(V)
+//
+// The update of K and V in the loop also runs when k is rejected because r
+// or s would be invalid.
+//
+// HMAC is computed with the buffers of the generator rather than
+// crypto/hmac, so that a generator can be reused without allocating.
+type nonceGenerator struct {
+	h          hash.Hash
+	k, v       [sm3.Size]byte
+	x, h1      [32]byte
+	entropy    [32]byte
+	inner      [sm3.Size]byte
+	ipad, opad [sm3.BlockSize]byte
+	first      bool
+}
+
+var (
+	nonceSep0 = []byte{0x00}
+	nonceSep1 = []byte{0x01}
+)
+
+func newNonceGenerator() *nonceGenerator {
+	return &nonceGenerator{h: sm3.New()}
+}
+
+// init starts the nonces for the private key d and digest, with extra as
+// the additional data k', which is empty for deterministic nonces.
+func (g *nonceGenerator) init(d *big.Int, digest, extra []byte) {
+	scalarBytes(&g.x, d)
+	g.setDigest(digest)
+	for i := range g.v {
+		g.v[i] = 0x01
+		g.k[i] = 0x00
+	}
+	g.mac(&g.k, g.v[:], nonceSep0, g.x[:], g.h1[:], extra)
+	g.mac(&g.v, g.v[:])
+	g.mac(&g.k, g.v[:], nonceSep1, g.x[:], g.h1[:], extra)
+	g.mac(&g.v, g.v[:])
+	g.x = [32]byte{}
+	g.first = true
+}
+
+// setDigest sets g.h1 to int2octets(digest mod n).
+func (g *nonceGenerator) setDigest(digest []byte) {
+	if len(digest) != 32 {
+		h1 := new(big.Int).SetBytes(digest)
+		h1.Mod(h1, sm2Curve.N)
+		scalarBytes(&g.h1, h1)
+		return
+	}
+	var e [4]uint64
+	sm2BigToLittle(e[:], digest)
+	reduceOnce(e[:], &e, 0, &sm2Ord)
+	sm2LittleToBig(g.h1[:], e[:])
+}
+
+// mac sets out to HMAC_K(data[0] || data[1] || ...), with K = g.k. out may
+// be g.k or g.v.
+func (g *nonceGenerator) mac(out *[sm3.Size]byte, data ...[]byte) {
+	for i := range g.ipad {
+		g.ipad[i], g.opad[i] = 0x36, 0x5c
+	}
+	for i, b := range g.k {
+		g.ipad[i] ^= b
+		g.opad[i] ^= b
+	}
+	g.h.Reset()
+	g.h.Write(g.ipad[:])
+	for _, b := range data {
+		g.h.Write(b)
+	}
+	g.h.Sum(g.inner[:0])
+	g.h.Reset()
+	g.h.Write(g.opad[:])
+	g.h.Write(g.inner[:])
+	g.h.Sum(out[:0])
+}
+
+// next sets k to the next candidate nonce in [1, n-1].
+func (g *nonceGenerator) next(k *[4]uint64) {
+	for {
+		if !g.first {
+			g.mac(&g.k, g.v[:], nonceSep0)
+			g.mac(&g.v, g.v[:])
+		}
+		g.first = false
+
+		g.mac(&g.v, g.v[:])
+		if scalarFromBytes(k, g.v[:]) {
+			return
+		}
+	}
+}
+
+// wipe clears the secret state of g.
+func (g *nonceGenerator) wipe() {
+	g.k, g.v, g.inner, g.entropy = [sm3.Size]byte{}, [sm3.Size]byte{}, [sm3.Size]byte{}, [32]byte{}
+	g.ipad, g.opad = [sm3.BlockSize]byte{}, [sm3.BlockSize]byte{}
+}
+
+// hedgedNonces starts g on the nonces of SignDigest: those of
+// SignDigestDeterministic, with 32 bytes of entropy read from random, or
+// from crypto/rand.Reader if random is nil, as the additional data k'.
+func hedgedNonces(g *nonceGenerator, d *big.Int, digest []byte, random io.Reader) error {
+	if random == nil {
+		random = rand.Reader
+	}
+	if _, err := io.ReadFull(random, g.entropy[:]); err != nil {
+		return err
+	}
+	g.init(d, digest, g.entropy[:])
+	return nil
+}
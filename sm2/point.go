@@ -15,53 +15,65 @@ import "math/big"
 var sm2Precomputed *[37][64 * 8]uint64
 
 func init() {
-	sm2Precomputed = new([37][64 * 8]uint64)
-
 	basePoint := []uint64{
 		0x61328990F418029E, 0x3E7981EDDCA6C050, 0xD6A1ED99AC24C3C3, 0x91167A5EE1C13B05,
 		0xC1354E593C2D0DDD, 0xC1F5E5788D3295FA, 0x8D4CFB066E2A48F8, 0x63CD65D481D735BD,
-		0x0000000000000001, 0x00000000FFFFFFFF, 0x0000000000000000, 0x0000000100000000,
 	}
-	t1 := make([]uint64, 12)
-	t2 := make([]uint64, 12)
-	copy(t2, basePoint)
-
-	zInv := make([]uint64, 4)
-	zInvSq := make([]uint64, 4)
-	for j := 0; j < 64; j++ {
-		copy(t1, t2)
-		for i := 0; i < 37; i++ {
-			// The window size is 7 so we need to double 7 times.
-			if i != 0 {
-				sm2PointDoubleAsm(t1, t1)
-				sm2PointDoubleAsm(t1, t1)
-				sm2PointDoubleAsm(t1, t1)
-				sm2PointDoubleAsm(t1, t1)
-				sm2PointDoubleAsm(t1, t1)
-				sm2PointDoubleAsm(t1, t1)
-				sm2PointDoubleAsm(t1, t1)
-			}
-
-			// Convert the point to affine form. (Its values are
-			// still in Montgomery form however.)
-			sm2Inverse(zInv, t1[8:12])
+	sm2Precomputed = precomputeTable(basePoint)
+}
 
-			sm2Sqr(zInvSq, zInv)
-			sm2Mul(zInv, zInv, zInvSq)
+// precomputeTable returns the table used by tableMult for the affine point
+// p, given in the Montgomery domain. Row i holds the multiples 1 to 64 of
+// [2^(7i)]p in affine form, with values still in the Montgomery domain.
+func precomputeTable(p []uint64) *[37][64 * 8]uint64 {
+	table := new([37][64 * 8]uint64)
 
-			sm2Mul(t1[:4], t1[:4], zInvSq)
-			sm2Mul(t1[4:8], t1[4:8], zInv)
+	// q is [2^(7i)]p and row its multiples, in Jacobian form.
+	var q [12]uint64
+	var row [64 * 12]uint64
+	copy(q[:8], p[:8])
+	// (This is one, in the Montgomery domain.)
+	q[8] = 0x0000000000000001
+	q[9] = 0x00000000FFFFFFFF
+	q[10] = 0x0000000000000000
+	q[11] = 0x0000000100000000
+
+	var prod [64 * 4]uint64
+	var inv, zInv, zInvSq [4]uint64
+	for i := 0; i < 37; i++ {
+		// The window size is 7 so we need to double 7 times.
+		if i != 0 {
+			for k := 0; k < 7; k++ {
+				sm2PointDoubleAsm(q[:], q[:])
+			}
+		}
+		copy(row[0:12], q[:])
+		sm2PointDoubleAsm(row[12:24], q[:])
+		for j := 2; j < 64; j++ {
+			sm2PointAddAsm(row[j*12:j*12+12], row[j*12-12:j*12], q[:])
+		}
 
-			copy(t1[8:12], basePoint[8:12])
-			// Update the table entry
-			copy(sm2Precomputed[i][j*8:], t1[:8])
+		// Convert the row to affine form with a single inversion: prod[j]
+		// is the product of the Z values of entries 0 to j.
+		copy(prod[0:4], row[8:12])
+		for j := 1; j < 64; j++ {
+			sm2Mul(prod[j*4:j*4+4], prod[j*4-4:j*4], row[j*12+8:j*12+12])
 		}
-		if j == 0 {
-			sm2PointDoubleAsm(t2, basePoint)
-		} else {
-			sm2PointAddAsm(t2, t2, basePoint)
+		sm2Inverse(inv[:], prod[63*4:])
+		for j := 63; j >= 0; j-- {
+			if j > 0 {
+				sm2Mul(zInv[:], inv[:], prod[j*4-4:j*4])
+				sm2Mul(inv[:], inv[:], row[j*12+8:j*12+12])
+			} else {
+				zInv = inv
+			}
+			sm2Sqr(zInvSq[:], zInv[:])
+			sm2Mul(zInv[:], zInv[:], zInvSq[:])
+			sm2Mul(table[i][j*8:j*8+4], row[j*12:j*12+4], zInvSq[:])
+			sm2Mul(table[i][j*8+4:j*8+8], row[j*12+4:j*12+8], zInv[:])
 		}
 	}
+	return table
 }
 
 type point struct {
@@ -89,14 +101,33 @@ func (p *point) pointToAffine() (x, y *big.Int) {
 	return new(big.Int).SetBytes(xOut), new(big.Int).SetBytes(yOut)
 }
 
+// affine sets x and y to the affine coordinates of p, out of the Montgomery
+// domain.
+func (p *point) affine(x, y []uint64) {
+	var zInv, zInvSq [4]uint64
+	sm2Inverse(zInv[:], p.xyz[8:12])
+	sm2Sqr(zInvSq[:], zInv[:])
+	sm2Mul(x, p.xyz[0:4], zInvSq[:])
+	sm2Mul(zInv[:], zInv[:], zInvSq[:])
+	sm2Mul(y, p.xyz[4:8], zInv[:])
+	sm2FromMont(x, x)
+	sm2FromMont(y, y)
+}
+
 func (p *point) p256StorePoint(r *[16 * 4 * 3]uint64, index int) {
 	copy(r[index*12:], p.xyz[:])
 }
 
 func (p *point) baseMult(scalar []uint64) {
+	p.tableMult(sm2Precomputed, scalar)
+}
+
+// tableMult sets p to [scalar]Q, where table was returned by
+// precomputeTable for Q.
+func (p *point) tableMult(table *[37][64 * 8]uint64, scalar []uint64) {
 	wValue := (scalar[0] << 1) & 0xff
 	sel, sign := boothW7(uint(wValue))
-	sm2SelectBase(p.xyz[0:8], sm2Precomputed[0][0:], sel)
+	sm2SelectBase(p.xyz[0:8], table[0][0:], sel)
 	sm2NegCond(p.xyz[4:8], sign)
 
 	// (This is one, in the Montgomery domain.)
@@ -125,7 +156,7 @@ func (p *point) baseMult(scalar []uint64) {
 		}
 		index += 7
 		sel, sign = boothW7(uint(wValue))
-		sm2SelectBase(t0.xyz[0:8], sm2Precomputed[i][0:], sel)
+		sm2SelectBase(t0.xyz[0:8], table[i][0:], sel)
 		sm2PointAddAffineAsm(p.xyz[0:12], p.xyz[0:12], t0.xyz[0:8], sign, sel, zero)
 		zero |= sel
 	}
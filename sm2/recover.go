@@ -0,0 +1,90 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// SignRecoverable signs digest like SignDigest and returns the 65 bytes
+// signature r || s || v, where the recovery id v in [0, 3] allows
+// RecoverPublicKey to compute the public key from the signature and the
+// digest, so that the key does not need to be sent along.
+//
+// The e = SM3(Z || M) of SignWithID cannot be computed without the public
+// key, since Z depends on it, so a recoverable signature must be made on a
+// digest that the verifier can compute from the message alone, such as
+// SM3(M). Z can be checked afterwards if needed, with the recovered key.
+func SignRecoverable(p *PrivateKey, digest []byte, random io.Reader) ([]byte, error) {
+	g := newNonceGenerator()
+	if err := hedgedNonces(g, p.D, digest, random); err != nil {
+		return nil, err
+	}
+	r, s, v, err := signWithNonce(p, digest, g.next)
+	g.wipe()
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 65)
+	copy(sig[:32], toBytes(r))
+	copy(sig[32:64], toBytes(s))
+	sig[64] = v
+	return sig, nil
+}
+
+// RecoverPublicKey returns the public key that made sig, a signature of
+// digest returned by SignRecoverable.
+//
+// With (x1, y1) = [k]G, the signature gives x1 = r - e mod n and the
+// recovery id gives x1 >= n and the parity of y1, so that [k]G is known.
+// Since s×(1 + d) = k - r×d, the public key is [d]G = (r + s)^-1×([k]G - [s]G).
+func RecoverPublicKey(digest, sig []byte) (*ecdsa.PublicKey, error) {
+	if len(sig) != 65 || sig[64] > 3 {
+		return nil, errors.New("invalid recoverable signature")
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	v := sig[64]
+	t, ok := signatureT(r, s)
+	if !ok {
+		return nil, errors.New("invalid signature")
+	}
+
+	params := sm2Curve.Params()
+	x1 := new(big.Int).Sub(r, new(big.Int).SetBytes(digest))
+	x1.Mod(x1, params.N)
+	if v&2 != 0 {
+		x1.Add(x1, params.N)
+	}
+	if x1.Cmp(params.P) >= 0 {
+		return nil, errors.New("invalid signature")
+	}
+	compressed := make([]byte, 33)
+	compressed[0] = 2 + v&1
+	copy(compressed[1:], toBytes(x1))
+	kx, ky, _, err := unmarshalPoint(compressed)
+	if err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	// The generic addition handles [k]G = ±[s]G, which would be tampered
+	// signatures.
+	sx, sy := sm2Curve.ScalarBaseMult(s.Bytes())
+	qx, qy := sm2Curve.Add(kx, ky, sx, new(big.Int).Sub(params.P, sy))
+	if !sm2Curve.IsOnCurve(qx, qy) {
+		return nil, errors.New("invalid signature")
+	}
+	x, y := sm2Curve.ScalarMult(qx, qy, sm2Curve.Inverse(t).Bytes())
+	return &ecdsa.PublicKey{Curve: sm2Curve, X: x, Y: y}, nil
+}
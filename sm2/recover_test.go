@@ -0,0 +1,164 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+func TestSignRecoverable(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		priv, _ := GenerateKey()
+		digest := sm3.SumSM3([]byte{byte(i)})
+		sig, err := SignRecoverable(priv, digest[:], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sig) != 65 || sig[64] > 3 {
+			t.Fatalf("#%d: invalid signature %x", i, sig)
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:64])
+		if !VerifyDigest(&priv.PublicKey, digest[:], r, s) {
+			t.Errorf("#%d: verification failed", i)
+		}
+
+		pub, err := RecoverPublicKey(digest[:], sig)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if pub.X.Cmp(priv.X) != 0 || pub.Y.Cmp(priv.Y) != 0 {
+			t.Errorf("#%d: recovered (%x, %x), want (%x, %x)", i, pub.X, pub.Y, priv.X, priv.Y)
+		}
+
+		// Another digest or recovery id gives another key, or none.
+		other := sm3.SumSM3([]byte{byte(i), 0})
+		if pub, err := RecoverPublicKey(other[:], sig); err == nil && pub.X.Cmp(priv.X) == 0 {
+			t.Errorf("#%d: recovered the key from another digest", i)
+		}
+		sig[64] ^= 1
+		if pub, err := RecoverPublicKey(digest[:], sig); err == nil && pub.X.Cmp(priv.X) == 0 {
+			t.Errorf("#%d: recovered the key with another recovery id", i)
+		}
+	}
+}
+
+// TestRecoverPublicKeyLargeX recovers the key of a signature for which x1 is
+// in [n, p), built like in TestVerifyBatchLargeX.
+func TestRecoverPublicKeyLargeX(t *testing.T) {
+	c := Curve()
+	params := c.Params()
+
+	x := new(big.Int).Sub(params.N, big.NewInt(1))
+	var y *big.Int
+	for y == nil {
+		x.Add(x, big.NewInt(1))
+		y2 := new(big.Int).Exp(x, big.NewInt(3), params.P)
+		y2.Sub(y2, new(big.Int).Mul(x, big.NewInt(3)))
+		y2.Add(y2, params.B)
+		y2.Mod(y2, params.P)
+		y = new(big.Int).ModSqrt(y2, params.P)
+	}
+
+	s := big.NewInt(12345)
+	tt := big.NewInt(67890)
+	gx, gy := c.ScalarBaseMult(new(big.Int).Sub(params.N, s).Bytes())
+	px, py := c.Add(x, y, gx, gy)
+	px, py = c.ScalarMult(px, py, new(big.Int).ModInverse(tt, params.N).Bytes())
+
+	r := new(big.Int).Sub(tt, s)
+	e := new(big.Int).Sub(r, x)
+	e.Mod(e, params.N)
+	digest := toBytes(e)
+
+	sig := make([]byte, 65)
+	copy(sig[:32], toBytes(r))
+	copy(sig[32:64], toBytes(s))
+	sig[64] = 2 | byte(y.Bit(0))
+	pub, err := RecoverPublicKey(digest, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.X.Cmp(px) != 0 || pub.Y.Cmp(py) != 0 {
+		t.Errorf("recovered (%x, %x), want (%x, %x)", pub.X, pub.Y, px, py)
+	}
+	if !VerifyDigest(pub, digest, r, s) {
+		t.Error("verification with the recovered key failed")
+	}
+}
+
+func TestSignRecoverableMatchesSignDigest(t *testing.T) {
+	priv := testKey()
+	digest := sm3.SumSM3([]byte("message"))
+	entropy := bytes.Repeat([]byte{0x42}, 32)
+	r, s, err := SignDigest(priv, digest[:], bytes.NewReader(entropy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := SignRecoverable(priv, digest[:], bytes.NewReader(entropy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig[:32], toBytes(r)) || !bytes.Equal(sig[32:64], toBytes(s)) {
+		t.Errorf("SignRecoverable = %x, want %x%x", sig[:64], toBytes(r), toBytes(s))
+	}
+}
+
+func TestRecoverPublicKeyErrors(t *testing.T) {
+	priv, _ := GenerateKey()
+	digest := make([]byte, 32)
+	rand.Read(digest)
+	sig, _ := SignRecoverable(priv, digest, nil)
+	N := sm2Curve.Params().N
+
+	tests := map[string]func(sig []byte) []byte{
+		"short":       func(sig []byte) []byte { return sig[:64] },
+		"long":        func(sig []byte) []byte { return append(sig, 0) },
+		"recovery id": func(sig []byte) []byte { sig[64] = 4; return sig },
+		"zero r":      func(sig []byte) []byte { copy(sig[:32], make([]byte, 32)); return sig },
+		"s = n":       func(sig []byte) []byte { copy(sig[32:64], toBytes(N)); return sig },
+		// x1 + n is almost always larger than p.
+		"x1 >= p": func(sig []byte) []byte { sig[64] |= 2; return sig },
+		"r + s = n": func(sig []byte) []byte {
+			s := new(big.Int).SetBytes(sig[32:64])
+			copy(sig[:32], toBytes(new(big.Int).Sub(N, s)))
+			return sig
+		},
+	}
+	for name, f := range tests {
+		bad := f(append([]byte(nil), sig...))
+		if _, err := RecoverPublicKey(digest, bad); err == nil {
+			t.Errorf("%s: RecoverPublicKey succeeded", name)
+		}
+	}
+
+	// [k]G = [s]G gives the point at infinity.
+	s := big.NewInt(1234)
+	kx, ky := sm2Curve.ScalarBaseMult(s.Bytes())
+	r := big.NewInt(5678)
+	e := new(big.Int).Sub(r, kx)
+	e.Mod(e, N)
+	bad := make([]byte, 65)
+	copy(bad[:32], toBytes(r))
+	copy(bad[32:64], toBytes(s))
+	bad[64] = byte(ky.Bit(0))
+	if kx.Cmp(N) >= 0 {
+		bad[64] |= 2
+	}
+	if _, err := RecoverPublicKey(toBytes(e), bad); err == nil {
+		t.Error("RecoverPublicKey of [k]G = [s]G succeeded")
+	}
+}
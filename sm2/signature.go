@@ -11,11 +11,9 @@
 package sm2
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/rand"
-	"crypto/sha512"
+	"encoding/asn1"
 	"errors"
 	"io"
 	"math/big"
@@ -25,93 +23,200 @@ import (
 
 // Sign generates signature for the input message using the private key and id.
 // It returns (r, s) as the signature or error.
+//
+// The message is hashed with LegacyID, use SignWithID to sign for other
+// SM2 implementations.
 func Sign(p *PrivateKey, msg []byte) (r, s *big.Int, err error) {
+	digest, err := legacyDigest(&p.PublicKey, msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return SignDigest(p, digest, rand.Reader)
+}
+
+// legacyDigest returns the digest signed by Sign, SM3(Z || msg) with the Z
+// of getZ.
+func legacyDigest(pub *ecdsa.PublicKey, msg []byte) ([]byte, error) {
 	h := sm3.New()
-	mz, err := getZ(msg, &p.PublicKey, h)
+	mz, err := getZ(msg, pub, h)
 	if err != nil {
-		return
+		return nil, err
 	}
 	h.Reset()
 	h.Write(mz)
-	digest := h.Sum(nil)
-
-	entropyLen := (p.Params().BitSize + 7) >> 4
-	if entropyLen > 32 {
-		entropyLen = 32
-	}
+	return h.Sum(nil), nil
+}
 
-	entropy := make([]byte, entropyLen)
-	_, err = io.ReadFull(rand.Reader, entropy)
+// SignWithID generates signature for the input message using the private key
+// and the signer ID, which may be of any length up to 8191 bytes. Most SM2
+// implementations expect DefaultID.
+func SignWithID(p *PrivateKey, msg, id []byte) (r, s *big.Int, err error) {
+	digest, err := CalculateDigest(&p.PublicKey, msg, id)
 	if err != nil {
-		return
+		return nil, nil, err
 	}
+	return SignDigest(p, digest, rand.Reader)
+}
 
-	priKey := p.D.Bytes()
+// SignDigest signs a digest e = SM3(Z || M) computed by the caller, for
+// instance with CalculateDigest. The nonce is derived from the private key,
+// the digest and entropy read from random, or from crypto/rand.Reader if
+// random is nil, as in RFC 6979 section 3.6 with HMAC-SM3.
+func SignDigest(p *PrivateKey, digest []byte, random io.Reader) (r, s *big.Int, err error) {
+	g := newNonceGenerator()
+	if err = hedgedNonces(g, p.D, digest, random); err != nil {
+		return nil, nil, err
+	}
+	r, s, _, err = signWithNonce(p, digest, g.next)
+	g.wipe()
+	return r, s, err
+}
 
-	md := sha512.New()
-	md.Write(priKey)
-	md.Write(entropy)
-	md.Write(digest[:])
+// SignDigestDeterministic signs a digest e = SM3(Z || M) like SignDigest,
+// but derives the nonce only from the private key and the digest, as in
+// RFC 6979 with HMAC-SM3, so that signing the same digest twice gives the
+// same signature and does not depend on the system random source.
+func SignDigestDeterministic(p *PrivateKey, digest []byte) (r, s *big.Int, err error) {
+	g := newNonceGenerator()
+	g.init(p.D, digest, nil)
+	r, s, _, err = signWithNonce(p, digest, g.next)
+	g.wipe()
+	return r, s, err
+}
 
-	block, err := aes.NewCipher(md.Sum(nil)[:32])
-	if err != nil {
-		return
+// signWithNonce computes the signature of e = digest, drawing nonces in
+// [1, n-1] from nextK until it yields a valid signature, and its recovery id.
+func signWithNonce(p *PrivateKey, digest []byte, nextK func(k *[4]uint64)) (r, s *big.Int, v byte, err error) {
+	if _, ok := p.Curve.(curve); !ok {
+		return nil, nil, 0, errors.New("the curve type is not SM2Curve")
 	}
-
-	cspRng := cipher.StreamReader{
-		R: zeroReader,
-		S: cipher.NewCTR(block, aesIV),
+	d, d1Inv, ok := signingScalars(p.D)
+	if !ok {
+		return nil, nil, 0, errors.New("invalid private key")
 	}
 
-	N := p.Params().N
-	if N.Sign() == 0 {
-		err = errors.New("zero parameter")
-		return
+	var e, k, rLimbs, sLimbs [4]uint64
+	bigE := new(big.Int).SetBytes(digest)
+	if bigE.BitLen() > 256 {
+		bigE.Mod(bigE, sm2Curve.N)
 	}
-	var k *big.Int
-	e := new(big.Int).SetBytes(digest[:])
+	fromBig(e[:], bigE)
+
 	for {
-		for {
-			k, err = randFieldElement(p.Curve, cspRng)
-			if err != nil {
-				r = nil
-				return
-			}
-
-			r, _ = p.ScalarBaseMult(k.Bytes())
-			r.Add(r, e)
-			r.Mod(r, N)
-			if r.Sign() != 0 {
-				break
-			}
-			if t := new(big.Int).Add(r, k); t.Cmp(N) == 0 {
-				break
-			}
-		}
-		D := new(big.Int).SetBytes(priKey)
-		rD := new(big.Int).Mul(D, r)
-		s = new(big.Int).Sub(k, rD)
-		d1 := new(big.Int).Add(D, one)
-		d1Inv := new(big.Int).ModInverse(d1, N)
-		s.Mul(s, d1Inv)
-		s.Mod(s, N)
-		if s.Sign() != 0 {
+		nextK(&k)
+		if v, ok = signLimbs(&rLimbs, &sLimbs, &d, &d1Inv, &e, &k); ok {
 			break
 		}
 	}
 
-	return
+	out := make([]byte, 32)
+	sm2LittleToBig(out, rLimbs[:])
+	r = new(big.Int).SetBytes(out)
+	sm2LittleToBig(out, sLimbs[:])
+	s = new(big.Int).SetBytes(out)
+	return r, s, v, nil
+}
+
+// signingScalars returns the private key d and (1 + d)^-1 in the Montgomery
+// domain modulo n, or ok = false if D is not in [1, n-2].
+func signingScalars(D *big.Int) (d, d1Inv [4]uint64, ok bool) {
+	if D == nil || D.Sign() <= 0 || D.BitLen() > 256 {
+		return d, d1Inv, false
+	}
+	fromBig(d[:], D)
+	if !lessThan(&d, &sm2Ord) {
+		return d, d1Inv, false
+	}
+	sm2OrdMul(d[:], d[:], sm2OrdRR[:])
+	sm2OrdAdd(d1Inv[:], d[:], sm2OrdOne[:])
+	if d1Inv == [4]uint64{} {
+		return d, d1Inv, false
+	}
+	sm2OrdInverse(d1Inv[:])
+	return d, d1Inv, true
+}
+
+// signLimbs sets r and s to the signature of e with the nonce k in [1, n-1],
+// given d and d1Inv from signingScalars, and returns its recovery id. It
+// reports false if k does not give a valid signature and another nonce must
+// be drawn.
+//
+// s = (1 + d)^-1 × (k - r×d) mod n is computed on fixed-size limbs with the
+// Montgomery arithmetic modulo n, and [k]G with the base point
+// multiplication, neither of which branches on d or k. The checks rejecting
+// k do branch, but only reveal that a nonce was discarded. This covers the
+// arithmetic only: d is still read from the *big.Int D by signingScalars.
+func signLimbs(r, s, d, d1Inv, e, k *[4]uint64) (v byte, ok bool) {
+	var q point
+	var y1, er [4]uint64
+	q.baseMult(k[:])
+	q.affine(r[:], y1[:])
+
+	// The recovery id holds the parity of y1 and whether x1 >= n.
+	v = byte(y1[0] & 1)
+	if !lessThan(r, &sm2Ord) {
+		v |= 2
+	}
+
+	// r = x1 + e mod n; x1 < p and e < 2^256 are both less than 2n.
+	reduceOnce(r[:], r, 0, &sm2Ord)
+	reduceOnce(er[:], e, 0, &sm2Ord)
+	sm2OrdAdd(r[:], r[:], er[:])
+	if *r == [4]uint64{} {
+		return 0, false
+	}
+	// Reject r + k = n.
+	sm2OrdAdd(s[:], r[:], k[:])
+	if *s == [4]uint64{} {
+		return 0, false
+	}
+
+	// Multiplying by a value in the Montgomery domain takes the other
+	// operand out of it, so s ends up out of the domain.
+	sm2OrdMul(s[:], r[:], d[:])
+	sm2OrdSub(s[:], k[:], s[:])
+	sm2OrdMul(s[:], s[:], d1Inv[:])
+	return v, *s != [4]uint64{}
 }
 
 // Verify checks whether the input (r, s) is a valid signature for the message.
+//
+// The message is hashed with LegacyID, use VerifyWithID for signatures made
+// by other SM2 implementations.
 func Verify(pub *ecdsa.PublicKey, msg []byte, r, s *big.Int) bool {
+	digest, err := legacyDigest(pub, msg)
+	if err != nil {
+		return false
+	}
+	return VerifyDigest(pub, digest, r, s)
+}
+
+// VerifyWithID checks whether the input (r, s) is a valid signature for the
+// message made with the signer ID.
+func VerifyWithID(pub *ecdsa.PublicKey, msg, id []byte, r, s *big.Int) bool {
+	digest, err := CalculateDigest(pub, msg, id)
+	if err != nil {
+		return false
+	}
+	return VerifyDigest(pub, digest, r, s)
+}
+
+// VerifyDigest checks whether the input (r, s) is a valid signature for the
+// digest e = SM3(Z || M).
+func VerifyDigest(pub *ecdsa.PublicKey, digest []byte, r, s *big.Int) bool {
 	N := pub.Params().N
 	if N.Sign() == 0 {
 		return false
 	}
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(N) >= 0 || s.Cmp(N) >= 0 {
+		return false
+	}
 
 	t := new(big.Int).Add(r, s)
 	t.Mod(t, N)
+	if t.Sign() == 0 {
+		return false
+	}
 
 	var x *big.Int
 	if opt, ok := pub.Curve.(combinedMult); ok {
@@ -122,15 +227,55 @@ func Verify(pub *ecdsa.PublicKey, msg []byte, r, s *big.Int) bool {
 		x, _ = pub.Add(x1, y1, x2, y2)
 	}
 
-	h := sm3.New()
-	mz, err := getZ(msg, pub, h)
+	x.Add(x, new(big.Int).SetBytes(digest))
+	x.Mod(x, N)
+	return x.Cmp(r) == 0
+}
+
+// MarshalSignature returns the ASN.1 DER encoding of the signature (r, s),
+// the form returned by PrivateKey.Sign.
+func MarshalSignature(r, s *big.Int) ([]byte, error) {
+	if r == nil || s == nil || r.Sign() <= 0 || s.Sign() <= 0 {
+		return nil, errors.New("invalid signature")
+	}
+	return asn1.Marshal(sm2Signature{r, s})
+}
+
+// UnmarshalSignature parses an ASN.1 DER encoded signature.
+func UnmarshalSignature(sig []byte) (r, s *big.Int, err error) {
+	var v sm2Signature
+	rest, err := asn1.Unmarshal(sig, &v)
 	if err != nil {
-		return false
+		return nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, errors.New("trailing data after signature")
 	}
+	if v.R.Sign() <= 0 || v.S.Sign() <= 0 {
+		return nil, nil, errors.New("invalid signature")
+	}
+	return v.R, v.S, nil
+}
 
-	h.Reset()
-	h.Write(mz)
-	x.Add(x, new(big.Int).SetBytes(h.Sum(nil)[:]))
-	x.Mod(x, N)
-	return x.Cmp(r) == 0
+// SignatureToRaw converts an ASN.1 DER encoded signature to the 64 bytes
+// r || s form.
+func SignatureToRaw(sig []byte) ([]byte, error) {
+	r, s, err := UnmarshalSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	if r.BitLen() > 256 || s.BitLen() > 256 {
+		return nil, errors.New("invalid signature")
+	}
+	return append(toBytes(r), toBytes(s)...), nil
+}
+
+// RawToSignature converts a 64 bytes r || s signature to ASN.1 DER.
+func RawToSignature(raw []byte) ([]byte, error) {
+	if len(raw) != 64 {
+		return nil, errors.New("the raw signature should be 64 bytes")
+	}
+	r := new(big.Int).SetBytes(raw[:32])
+	s := new(big.Int).SetBytes(raw[32:])
+	return MarshalSignature(r, s)
 }
@@ -11,11 +11,17 @@
 package sm2
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/asn1"
+	"encoding/hex"
 	"io"
+	"math/big"
 	"testing"
+	"testing/iotest"
 	//flyinox "github.com/flyinox/crypto/sm/sm2"
 	//mixbee_keypair "github.com/mixbee/mixbee-crypto/keypair"
 	//mixbee_signature "github.com/mixbee/mixbee-crypto/signature"
@@ -36,6 +42,514 @@ func TestSignAndVerify(t *testing.T) {
 	}
 }
 
+// Signatures of "message digest" made with testKey by
+// "openssl pkeyutl -sign -rawin -digest sm3 -pkeyopt distid:<id>".
+var opensslSignatureTests = []struct {
+	id   []byte
+	r, s string
+}{
+	{DefaultID, "7a64def1632d941fabfe29c064ef80f3ddb2e7d7da91f7c3d72e2e57fcbdf05b", "34311c3643f102c9ef976859f6a6c2a09db42aabd5851ae7b0824bba5249427a"},
+	{[]byte("ALICE123@YAHOO.COM"), "8915d678a1b5ece4cc8795d392cdc4cf366a78da9c6db97432d26da3e7a3b96d", "fddbf3ac231b4b3ecc282bd9ea22f8b9b1f74ef0b9f87e99b778b3a154da2265"},
+	// OpenSSL 3 signs with an empty ID when no distid is given.
+	{[]byte{}, "59c8ed27d1b49d6fadd65c0196601d2c31da6f8c0d5ac44eecd9b40062d0f791", "1424dedefddf94059dda9805c97aad12875d729795898f6d0c0cb627bd194356"},
+}
+
+func TestVerifyWithIDOpenSSL(t *testing.T) {
+	pub := &testKey().PublicKey
+	msg := []byte("message digest")
+	for i, test := range opensslSignatureTests {
+		r, _ := new(big.Int).SetString(test.r, 16)
+		s, _ := new(big.Int).SetString(test.s, 16)
+		if !VerifyWithID(pub, msg, test.id, r, s) {
+			t.Errorf("#%d: verification failed", i)
+		}
+		if VerifyWithID(pub, []byte("message digesT"), test.id, r, s) {
+			t.Errorf("#%d: verification of another message succeeded", i)
+		}
+		if VerifyWithID(pub, msg, LegacyID, r, s) {
+			t.Errorf("#%d: verification with LegacyID succeeded", i)
+		}
+	}
+}
+
+func TestSignWithID(t *testing.T) {
+	msg := []byte("test message 123012301230")
+	priKey, _ := GenerateKey()
+	for _, id := range [][]byte{DefaultID, {}, []byte("a much longer signer ID than the usual sixteen bytes")} {
+		r, s, err := SignWithID(priKey, msg, id)
+		if err != nil {
+			t.Fatalf("signing error: %s", err)
+		}
+		if !VerifyWithID(&priKey.PublicKey, msg, id, r, s) {
+			t.Errorf("verification with ID %q failed", id)
+		}
+		if VerifyWithID(&priKey.PublicKey, msg, []byte("other"), r, s) {
+			t.Errorf("verification with the wrong ID succeeded")
+		}
+	}
+
+	if _, _, err := SignWithID(priKey, msg, make([]byte, 8192)); err == nil {
+		t.Error("signing with an ID of 8192 bytes succeeded")
+	}
+
+	r, s, _ := SignWithID(priKey, msg, LegacyID)
+	if !Verify(&priKey.PublicKey, msg, r, s) {
+		t.Error("Verify rejected a signature made with LegacyID")
+	}
+}
+
+func TestLegacyIDLeadingZero(t *testing.T) {
+	// The y coordinate of the public key has a leading zero byte, which Sign
+	// and Verify do not hash.
+	priKey, _ := NewPrivateKey([]byte{107})
+	pub := &priKey.PublicKey
+	if len(pub.Y.Bytes()) != 31 {
+		t.Fatalf("y = %x has no leading zero byte", pub.Y)
+	}
+	msg := []byte("test message 123012301230")
+
+	want, _ := legacyDigest(pub, msg)
+	if got, _ := CalculateDigest(pub, msg, LegacyID); !bytes.Equal(got, want) {
+		t.Errorf("CalculateDigest with LegacyID = %x, want %x", got, want)
+	}
+	if got, _ := CalculateDigest(pub, msg, DefaultID); bytes.Equal(got, want) {
+		t.Error("CalculateDigest with DefaultID matches the digest of Sign")
+	}
+
+	r, s, _ := Sign(priKey, msg)
+	if !VerifyWithID(pub, msg, LegacyID, r, s) {
+		t.Error("VerifyWithID with LegacyID rejected a signature made by Sign")
+	}
+	r, s, _ = SignWithID(priKey, msg, LegacyID)
+	if !Verify(pub, msg, r, s) {
+		t.Error("Verify rejected a signature made with LegacyID")
+	}
+	der, _ := priKey.Sign(rand.Reader, msg, &SignerOpts{UID: LegacyID})
+	if !(&PublicKey{pub}).VerifyASN1(msg, der, nil) {
+		t.Error("VerifyASN1 rejected a signature made with SignerOpts.UID = LegacyID")
+	}
+	v, _ := NewVerifierWithID(pub, LegacyID)
+	if !v.Verify(msg, r, s) {
+		t.Error("Verifier with LegacyID rejected a signature made with LegacyID")
+	}
+}
+
+func TestPrivateKeySignWithOpts(t *testing.T) {
+	msg := []byte("test message 123012301230")
+	priKey, _ := GenerateKey()
+
+	digest, _ := CalculateDigest(&priKey.PublicKey, msg, DefaultID)
+
+	for _, test := range []struct {
+		input []byte
+		opts  crypto.SignerOpts
+		id    []byte
+	}{
+		{msg, &SignerOpts{}, DefaultID},
+		{msg, &SignerOpts{UID: []byte("ALICE123@YAHOO.COM")}, []byte("ALICE123@YAHOO.COM")},
+		{digest, &SignerOpts{Digest: true, UID: []byte("ignored")}, DefaultID},
+		{msg, crypto.Hash(0), LegacyID},
+		{msg, nil, LegacyID},
+	} {
+		der, err := priKey.Sign(rand.Reader, test.input, test.opts)
+		if err != nil {
+			t.Fatalf("signing error: %s", err)
+		}
+		var sig sm2Signature
+		if _, err := asn1.Unmarshal(der, &sig); err != nil {
+			t.Fatalf("invalid signature %s: %s", hex.EncodeToString(der), err)
+		}
+		if !VerifyWithID(&priKey.PublicKey, msg, test.id, sig.R, sig.S) {
+			t.Errorf("verification with ID %q failed", test.id)
+		}
+	}
+}
+
+// TestSignerOptsWithoutID pins the ID used by each opts that does not name
+// one: only a non-nil *SignerOpts switches to DefaultID.
+func TestSignerOptsWithoutID(t *testing.T) {
+	msg := []byte("test message 123012301230")
+	priKey, _ := NewPrivateKey([]byte{107})
+	pub := &PublicKey{&priKey.PublicKey}
+	legacyR, legacyS, _ := Sign(priKey, msg)
+	defaultR, defaultS, _ := SignWithID(priKey, msg, DefaultID)
+
+	for _, test := range []struct {
+		name string
+		opts crypto.SignerOpts
+		id   []byte
+	}{
+		{"nil", nil, LegacyID},
+		{"nil *SignerOpts", (*SignerOpts)(nil), LegacyID},
+		{"crypto.Hash(0)", crypto.Hash(0), LegacyID},
+		{"&SignerOpts{}", &SignerOpts{}, DefaultID},
+	} {
+		other := DefaultID
+		r, s := legacyR, legacyS
+		if bytes.Equal(test.id, DefaultID) {
+			other = LegacyID
+			r, s = defaultR, defaultS
+		}
+
+		der, err := priKey.Sign(rand.Reader, msg, test.opts)
+		if err != nil {
+			t.Fatalf("%s: signing error: %s", test.name, err)
+		}
+		sr, ss, _ := UnmarshalSignature(der)
+		if !VerifyWithID(pub.PublicKey, msg, test.id, sr, ss) {
+			t.Errorf("%s: signature not made with ID %q", test.name, test.id)
+		}
+		if VerifyWithID(pub.PublicKey, msg, other, sr, ss) {
+			t.Errorf("%s: signature verifies with ID %q", test.name, other)
+		}
+		if !pub.Verify(msg, r, s, test.opts) {
+			t.Errorf("%s: Verify rejected a signature made with ID %q", test.name, test.id)
+		}
+		if !pub.VerifyASN1(msg, der, test.opts) {
+			t.Errorf("%s: VerifyASN1 rejected the signature of Sign", test.name)
+		}
+	}
+}
+
+func TestPrivateKeySignErrors(t *testing.T) {
+	priKey, _ := GenerateKey()
+	var signer crypto.Signer = priKey
+
+	if _, err := signer.Sign(rand.Reader, []byte("short"), &SignerOpts{Digest: true}); err == nil {
+		t.Error("signed a digest of the wrong length")
+	}
+	for _, h := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		if _, err := signer.Sign(rand.Reader, make([]byte, h.Size()), h); err == nil {
+			t.Errorf("signed a digest of %v", h)
+		}
+	}
+
+	// The random source must be used.
+	failing := iotest.TimeoutReader(bytes.NewReader(nil))
+	if _, err := signer.Sign(failing, []byte("msg"), &SignerOpts{}); err == nil {
+		t.Error("signing succeeded with a failing random source")
+	}
+}
+
+func TestPublicKeyVerifyASN1(t *testing.T) {
+	msg := []byte("test message 123012301230")
+	priKey, _ := GenerateKey()
+	pub := priKey.Public().(*PublicKey)
+	digest, _ := CalculateDigest(pub.PublicKey, msg, DefaultID)
+
+	for _, test := range []struct {
+		input []byte
+		opts  crypto.SignerOpts
+	}{
+		{msg, nil},
+		{msg, &SignerOpts{}},
+		{msg, &SignerOpts{UID: []byte("ALICE123@YAHOO.COM")}},
+		{digest, &SignerOpts{Digest: true}},
+	} {
+		sig, err := priKey.Sign(nil, test.input, test.opts)
+		if err != nil {
+			t.Fatalf("signing error: %s", err)
+		}
+		if !pub.VerifyASN1(test.input, sig, test.opts) {
+			t.Errorf("opts %#v: verification failed", test.opts)
+		}
+		if pub.VerifyASN1([]byte("other"), sig, test.opts) {
+			t.Errorf("opts %#v: verified the wrong message", test.opts)
+		}
+		if pub.VerifyASN1(test.input, append(sig, 0), test.opts) {
+			t.Errorf("opts %#v: verified a signature with trailing data", test.opts)
+		}
+	}
+
+	sig, _ := priKey.Sign(nil, digest, &SignerOpts{Digest: true})
+	if pub.VerifyASN1(digest, sig, crypto.SHA256) {
+		t.Error("verified a digest passed with crypto.SHA256")
+	}
+
+	other, _ := GenerateKey()
+	if !pub.Equal(&PublicKey{&priKey.PublicKey}) || !pub.Equal(&priKey.PublicKey) {
+		t.Error("Equal rejected the same key")
+	}
+	if pub.Equal(other.Public()) || pub.Equal(nil) {
+		t.Error("Equal accepted a different key")
+	}
+	empty := &ecdsa.PublicKey{Curve: sm2Curve}
+	if pub.Equal(empty) || (&PublicKey{empty}).Equal(pub) {
+		t.Error("Equal accepted a key without coordinates")
+	}
+}
+
+func TestSignatureRaw(t *testing.T) {
+	for _, test := range opensslSignatureTests {
+		raw, _ := hex.DecodeString(test.r + test.s)
+		der, err := RawToSignature(raw)
+		if err != nil {
+			t.Fatalf("RawToSignature: %s", err)
+		}
+		r, s, err := UnmarshalSignature(der)
+		if err != nil || hex.EncodeToString(toBytes(r)) != test.r || hex.EncodeToString(toBytes(s)) != test.s {
+			t.Errorf("UnmarshalSignature = %x, %x, %v", r, s, err)
+		}
+		back, err := SignatureToRaw(der)
+		if err != nil || !bytes.Equal(back, raw) {
+			t.Errorf("SignatureToRaw = %x, %v, want %x", back, err, raw)
+		}
+	}
+
+	if _, err := RawToSignature(make([]byte, 64)); err == nil {
+		t.Error("converted a zero signature")
+	}
+	if _, err := RawToSignature(make([]byte, 63)); err == nil {
+		t.Error("converted a short signature")
+	}
+	if _, _, err := UnmarshalSignature([]byte{0x30, 0x00}); err == nil {
+		t.Error("parsed an empty signature")
+	}
+}
+
+// deterministicTests are signatures by testKey with RFC 6979 nonces over
+// HMAC-SM3, computed by an independent implementation. The signatures
+// verify with OpenSSL.
+var deterministicTests = []struct {
+	id, msg    string
+	e, k, r, s string
+}{
+	{
+		"1234567812345678", "sample",
+		"469f47d743772f5192d907d556169d0ffc698a35673e393420cc82b1e7a5b70f",
+		"eebaed2ba4df5252955dc85de152c48af3213893fa099c3042355535dc1a370b",
+		"c9244636e6b2e17e2608243ec7b5a4c8efe753df4807cfcd670c435d5e0eaf05",
+		"2b2ebb93a0c4172d29dda81daf430e2f197e9053dac2e808125e65b4f37be478",
+	},
+	{
+		"1234567812345678", "test",
+		"9d8b71fce6d82ab100760fa37f3db731efb0532aaed5315b951164017f3d90eb",
+		"7f413460fc1c09240e486c4ef84905485fba183d89e7603fc94d09086ef9a983",
+		"24a9342f255d1591908be64f6e592058b615551cbe255ebdb0c6a066ca1efdf2",
+		"e51776804980218ed7f458130a5fc148120c9b9d5a33ef44c9797a0ab318a2b1",
+	},
+	{
+		"ALICE123@YAHOO.COM", "message digest",
+		"6e514b7a62b0ed71bcbcc1e0e273f7be888435c640127f405b82ad3c2264562d",
+		"7c0833092d793c78022fca6189397ec55b770706bb2b37f6493a9e0b4f64f269",
+		"df33e88d62f445ad0551783c7215f8e6c809b440015fa6ec83fedc5896ef46f3",
+		"3b5147471d5f434f96c5565d49363f91f997b02c867e92fb1896bca977b2d4e7",
+	},
+}
+
+func TestSignDeterministic(t *testing.T) {
+	priKey := testKey()
+	for i, test := range deterministicTests {
+		e, err := CalculateDigest(&priKey.PublicKey, []byte(test.msg), []byte(test.id))
+		if err != nil || hex.EncodeToString(e) != test.e {
+			t.Fatalf("#%d: e = %x, %v", i, e, err)
+		}
+		var k [4]uint64
+		g := newNonceGenerator()
+		g.init(priKey.D, e, nil)
+		g.next(&k)
+		kb := make([]byte, 32)
+		sm2LittleToBig(kb, k[:])
+		if hex.EncodeToString(kb) != test.k {
+			t.Errorf("#%d: k = %x, want %s", i, kb, test.k)
+		}
+		r, s, err := SignDigestDeterministic(priKey, e)
+		if err != nil {
+			t.Fatalf("#%d: signing error: %s", i, err)
+		}
+		if hex.EncodeToString(toBytes(r)) != test.r || hex.EncodeToString(toBytes(s)) != test.s {
+			t.Errorf("#%d: got (%x, %x), want (%s, %s)", i, r, s, test.r, test.s)
+		}
+
+		// Sign must not read from the random source.
+		opts := &SignerOpts{UID: []byte(test.id), Deterministic: true}
+		failing := iotest.TimeoutReader(bytes.NewReader(nil))
+		sig, err := priKey.Sign(failing, []byte(test.msg), opts)
+		if err != nil {
+			t.Fatalf("#%d: Sign: %s", i, err)
+		}
+		raw, _ := SignatureToRaw(sig)
+		if hex.EncodeToString(raw) != test.r+test.s {
+			t.Errorf("#%d: Sign returned %x", i, raw)
+		}
+	}
+}
+
+func TestVerifyRejectsOutOfRange(t *testing.T) {
+	msg := []byte("test message 123012301230")
+	priKey, _ := GenerateKey()
+	r, s, _ := Sign(priKey, msg)
+	N := sm2Curve.Params().N
+	for _, sig := range [][2]*big.Int{
+		{new(big.Int), s},
+		{r, new(big.Int)},
+		{new(big.Int).Add(r, N), s},
+		{r, new(big.Int).Add(s, N)},
+		{new(big.Int).Neg(r), s},
+	} {
+		if Verify(&priKey.PublicKey, msg, sig[0], sig[1]) {
+			t.Errorf("verification of (%x, %x) succeeded", sig[0], sig[1])
+		}
+	}
+}
+
+// signWithNonceBig is the math/big implementation of signWithNonce that
+// predates the constant time one.
+func signWithNonceBig(p *PrivateKey, digest []byte, nextK func() (*big.Int, error)) (r, s *big.Int, err error) {
+	N := p.Params().N
+	e := new(big.Int).SetBytes(digest)
+	D := p.D
+	for {
+		k, err := nextK()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r, _ = p.ScalarBaseMult(k.Bytes())
+		r.Add(r, e)
+		r.Mod(r, N)
+		if r.Sign() == 0 {
+			continue
+		}
+		if t := new(big.Int).Add(r, k); t.Cmp(N) == 0 {
+			continue
+		}
+
+		rD := new(big.Int).Mul(D, r)
+		s = new(big.Int).Sub(k, rD)
+		d1 := new(big.Int).Add(D, one)
+		d1Inv := new(big.Int).ModInverse(d1, N)
+		s.Mul(s, d1Inv)
+		s.Mod(s, N)
+		if s.Sign() != 0 {
+			return r, s, nil
+		}
+	}
+}
+
+// limbNonces adapts nextK of signWithNonceBig, which must not fail, to
+// signWithNonce.
+func limbNonces(nextK func() (*big.Int, error)) func(k *[4]uint64) {
+	return func(k *[4]uint64) {
+		bigK, err := nextK()
+		if err != nil {
+			panic(err)
+		}
+		fromBig(k[:], bigK)
+	}
+}
+
+func TestSignWithNonceMatchesBig(t *testing.T) {
+	N := sm2Curve.Params().N
+	nMinus := func(i int64) *big.Int { return new(big.Int).Sub(N, big.NewInt(i)) }
+
+	keys := []*PrivateKey{testKey()}
+	for _, d := range []*big.Int{big.NewInt(1), big.NewInt(2), nMinus(2), nMinus(3)} {
+		x, y := sm2Curve.ScalarBaseMult(d.Bytes())
+		keys = append(keys, &PrivateKey{&ecdsa.PrivateKey{D: d, PublicKey: ecdsa.PublicKey{Curve: sm2Curve, X: x, Y: y}}})
+	}
+	for i := 0; i < 5; i++ {
+		priv, _ := GenerateKey()
+		keys = append(keys, priv)
+	}
+
+	for i, priv := range keys {
+		for j := 0; j < 20; j++ {
+			digest := make([]byte, 32)
+			rand.Read(digest)
+			var k *big.Int
+			switch j {
+			case 0:
+				k = big.NewInt(1)
+			case 1:
+				k = nMinus(1)
+			default:
+				k, _ = rand.Int(rand.Reader, nMinus(1))
+				k.Add(k, one)
+			}
+			nextK := func() (*big.Int, error) { return k, nil }
+
+			r, s, _, err := signWithNonce(priv, digest, limbNonces(nextK))
+			if err != nil {
+				t.Fatalf("#%d/%d: %s", i, j, err)
+			}
+			wantR, wantS, _ := signWithNonceBig(priv, digest, nextK)
+			if r.Cmp(wantR) != 0 || s.Cmp(wantS) != 0 {
+				t.Errorf("#%d/%d: signWithNonce(d = %x, k = %x) = (%x, %x), want (%x, %x)", i, j, priv.D, k, r, s, wantR, wantS)
+			}
+			if !VerifyDigest(&priv.PublicKey, digest, r, s) {
+				t.Errorf("#%d/%d: verification failed", i, j)
+			}
+		}
+	}
+}
+
+func TestSignWithNonceRejects(t *testing.T) {
+	priv := testKey()
+	N := sm2Curve.Params().N
+
+	// A nonce making r + k = n is rejected, and the next one is used.
+	k := big.NewInt(1234567)
+	x, _ := sm2Curve.ScalarBaseMult(k.Bytes())
+	r := new(big.Int).Sub(N, k)
+	e := new(big.Int).Sub(r, x)
+	e.Mod(e, N)
+	digest := toBytes(e)
+	nonces := []*big.Int{k, big.NewInt(42)}
+	nextK := func() (*big.Int, error) {
+		k := nonces[0]
+		nonces = nonces[1:]
+		return k, nil
+	}
+	r, s, _, err := signWithNonce(priv, digest, limbNonces(nextK))
+	if err != nil || len(nonces) != 0 {
+		t.Fatalf("signWithNonce = %v, %d nonces left", err, len(nonces))
+	}
+	if !VerifyDigest(&priv.PublicKey, digest, r, s) {
+		t.Error("verification failed")
+	}
+
+	for _, d := range []*big.Int{new(big.Int), new(big.Int).Sub(N, one), N} {
+		bad := &PrivateKey{&ecdsa.PrivateKey{D: d, PublicKey: priv.PublicKey}}
+		if _, _, err := SignDigest(bad, digest, nil); err == nil {
+			t.Errorf("SignDigest with d = %x succeeded", d)
+		}
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, _, err := SignDigest(&PrivateKey{p256}, digest, nil); err == nil {
+		t.Error("SignDigest with a P-256 key succeeded")
+	}
+}
+
+func TestScalarEncoding(t *testing.T) {
+	N := sm2Curve.Params().N
+	max := new(big.Int).Sub(new(big.Int).Lsh(one, 256), one)
+	for _, test := range []struct {
+		k     *big.Int
+		valid bool
+	}{
+		{new(big.Int), false},
+		{big.NewInt(1), true},
+		{new(big.Int).Lsh(one, 64), true},
+		{new(big.Int).Sub(N, one), true},
+		{N, false},
+		{max, false},
+	} {
+		var b [32]byte
+		scalarBytes(&b, test.k)
+		if !bytes.Equal(b[:], toBytes(test.k)) {
+			t.Errorf("scalarBytes(%x) = %x", test.k, b)
+		}
+		var k [4]uint64
+		if scalarFromBytes(&k, b[:]) != test.valid {
+			t.Errorf("scalarFromBytes(%x) = %v, want %v", test.k, !test.valid, test.valid)
+		}
+		if limbsToBig(k[:]).Cmp(test.k) != 0 {
+			t.Errorf("scalarFromBytes(%x) set k = %x", test.k, limbsToBig(k[:]))
+		}
+	}
+}
+
 func BenchmarkSM2Sign(b *testing.B) {
 	msg := make([]byte, 256)
 	_, _ = io.ReadFull(rand.Reader, msg[:])
@@ -59,6 +573,15 @@ func BenchmarkSM2Sign(b *testing.B) {
 		}
 	})
 
+	b.Run("rongzer-sm2-bytes", func(b *testing.B) {
+		priKey, _ := GenerateKey()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			SignBytes(priKey, msg)
+		}
+	})
+
 	//b.Run("flyinox-sm2", func(b *testing.B) {
 	//	priKey, _ := flyinox.GenerateKey(rand.Reader)
 	//	b.ReportAllocs()
@@ -112,6 +635,16 @@ func BenchmarkSM2Verify(b *testing.B) {
 		}
 	})
 
+	b.Run("rongzer-sm2-bytes", func(b *testing.B) {
+		priKey, _ := GenerateKey()
+		sig, _ := SignBytes(priKey, msg)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			VerifyBytes(&priKey.PublicKey, msg, sig)
+		}
+	})
+
 	//b.Run("flyinox-sm2", func(b *testing.B) {
 	//	priKey, _ := flyinox.GenerateKey(rand.Reader)
 	//	r, s, _ := flyinox.Sign(rand.Reader, priKey, msg)
@@ -0,0 +1,123 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"hash"
+	"sync"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+// scratch holds the buffers of SignBytes and VerifyBytes, which are reused
+// through scratchPool so that they do not allocate.
+type scratch struct {
+	h      hash.Hash
+	nonces *nonceGenerator
+	buf    [32]byte
+	digest [32]byte
+}
+
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		return &scratch{h: sm3.New(), nonces: newNonceGenerator()}
+	},
+}
+
+// legacyDigest sets e to the digest of msg signed by Sign, hashed with the
+// Z value of getZ, and also stores it in sc.digest.
+func (sc *scratch) legacyDigest(e *[4]uint64, pub *ecdsa.PublicKey, msg []byte) {
+	h := sc.h
+	writeZ(h, &sc.buf, uid, pub)
+	z := h.Sum(sc.buf[:0])
+
+	h.Reset()
+	h.Write(z)
+	h.Write(msg)
+	h.Sum(sc.digest[:0])
+	sm2BigToLittle(e[:], sc.digest[:])
+}
+
+// validCoordinates reports whether the coordinates of pub fit in 256 bits.
+func validCoordinates(pub *ecdsa.PublicKey) bool {
+	return pub.X != nil && pub.Y != nil && pub.X.BitLen() <= 256 && pub.Y.BitLen() <= 256
+}
+
+// SignBytes is like Sign, but returns the signature as r || s, the format
+// of SignatureToRaw, in a fixed-size array and does not allocate.
+//
+// The nonces are those of SignDigest, with entropy read from
+// crypto/rand.Reader.
+func SignBytes(priv *PrivateKey, msg []byte) (sig [64]byte, err error) {
+	if _, ok := priv.Curve.(curve); !ok {
+		return sig, errors.New("the curve type is not SM2Curve")
+	}
+	if !validCoordinates(&priv.PublicKey) {
+		return sig, errors.New("invalid public key")
+	}
+	d, d1Inv, ok := signingScalars(priv.D)
+	if !ok {
+		return sig, errors.New("invalid private key")
+	}
+
+	sc := scratchPool.Get().(*scratch)
+	defer scratchPool.Put(sc)
+	var e, k, r, s [4]uint64
+	sc.legacyDigest(&e, &priv.PublicKey, msg)
+	if err = hedgedNonces(sc.nonces, priv.D, sc.digest[:], rand.Reader); err != nil {
+		return sig, err
+	}
+	for {
+		sc.nonces.next(&k)
+		if _, ok := signLimbs(&r, &s, &d, &d1Inv, &e, &k); ok {
+			break
+		}
+	}
+	sc.nonces.wipe()
+
+	sm2LittleToBig(sig[:32], r[:])
+	sm2LittleToBig(sig[32:], s[:])
+	return sig, nil
+}
+
+// VerifyBytes is like Verify for a signature r || s as returned by
+// SignBytes, and does not allocate.
+func VerifyBytes(pub *ecdsa.PublicKey, msg []byte, sig [64]byte) bool {
+	if pub == nil || !validCoordinates(pub) {
+		return false
+	}
+	if _, ok := pub.Curve.(curve); !ok {
+		return false
+	}
+	var r, s, t, e [4]uint64
+	sm2BigToLittle(r[:], sig[:32])
+	sm2BigToLittle(s[:], sig[32:])
+	if r == [4]uint64{} || s == [4]uint64{} || !lessThan(&r, &sm2Ord) || !lessThan(&s, &sm2Ord) {
+		return false
+	}
+	sm2OrdAdd(t[:], r[:], s[:])
+	if t == [4]uint64{} {
+		return false
+	}
+
+	sc := scratchPool.Get().(*scratch)
+	sc.legacyDigest(&e, pub, msg)
+	scratchPool.Put(sc)
+
+	// x1 + e = r mod n, with e < 2^256 less than 2n.
+	reduceOnce(e[:], &e, 0, &sm2Ord)
+	sm2OrdSub(e[:], r[:], e[:])
+	p := combinedMultLimbs(pub.X, pub.Y, s[:], t[:])
+	return p.hasXLimbs(&e)
+}
@@ -0,0 +1,104 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestSignBytes(t *testing.T) {
+	priv, _ := GenerateKey()
+	other, _ := GenerateKey()
+	for i := 0; i < 20; i++ {
+		msg := make([]byte, i*20)
+		rand.Read(msg)
+		sig, err := SignBytes(priv, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !Verify(&priv.PublicKey, msg, r, s) {
+			t.Errorf("#%d: Verify rejected the signature of SignBytes", i)
+		}
+		if !VerifyBytes(&priv.PublicKey, msg, sig) {
+			t.Errorf("#%d: VerifyBytes failed", i)
+		}
+		if VerifyBytes(&other.PublicKey, msg, sig) {
+			t.Errorf("#%d: VerifyBytes with another key succeeded", i)
+		}
+		if VerifyBytes(&priv.PublicKey, append(msg, 1), sig) {
+			t.Errorf("#%d: VerifyBytes of another message succeeded", i)
+		}
+
+		r, s, _ = Sign(priv, msg)
+		copy(sig[:32], toBytes(r))
+		copy(sig[32:], toBytes(s))
+		if !VerifyBytes(&priv.PublicKey, msg, sig) {
+			t.Errorf("#%d: VerifyBytes rejected the signature of Sign", i)
+		}
+		sig[i%64] ^= 0x10
+		if VerifyBytes(&priv.PublicKey, msg, sig) {
+			t.Errorf("#%d: VerifyBytes of a modified signature succeeded", i)
+		}
+	}
+}
+
+func TestVerifyBytesRejectsOutOfRange(t *testing.T) {
+	msg := []byte("test message 123012301230")
+	priv, _ := GenerateKey()
+	sig, _ := SignBytes(priv, msg)
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	N := sm2Curve.Params().N
+	for _, rs := range [][2]*big.Int{
+		{new(big.Int), s},
+		{r, new(big.Int)},
+		{N, s},
+		{r, N},
+		{new(big.Int).Sub(N, s), s},
+	} {
+		var bad [64]byte
+		copy(bad[:32], toBytes(rs[0]))
+		copy(bad[32:], toBytes(rs[1]))
+		if VerifyBytes(&priv.PublicKey, msg, bad) {
+			t.Errorf("verification of (%x, %x) succeeded", rs[0], rs[1])
+		}
+	}
+
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if VerifyBytes(&p256.PublicKey, msg, sig) || VerifyBytes(nil, msg, sig) {
+		t.Error("VerifyBytes with an invalid key succeeded")
+	}
+	if _, err := SignBytes(&PrivateKey{p256}, msg); err == nil {
+		t.Error("SignBytes with a P-256 key succeeded")
+	}
+	bad := &PrivateKey{&ecdsa.PrivateKey{D: N, PublicKey: priv.PublicKey}}
+	if _, err := SignBytes(bad, msg); err == nil {
+		t.Error("SignBytes with d = n succeeded")
+	}
+}
+
+func TestSignBytesAllocations(t *testing.T) {
+	priv, _ := GenerateKey()
+	msg := make([]byte, 256)
+	sig, _ := SignBytes(priv, msg)
+	if n := testing.AllocsPerRun(100, func() { SignBytes(priv, msg) }); n > 0 {
+		t.Errorf("SignBytes allocates %v times", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { VerifyBytes(&priv.PublicKey, msg, sig) }); n > 0 {
+		t.Errorf("VerifyBytes allocates %v times", n)
+	}
+}
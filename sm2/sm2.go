@@ -11,18 +11,31 @@
 package sm2
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"errors"
 	"hash"
 	"io"
 	"math/big"
+	"math/bits"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+var (
+	uid = []byte{0x72, 0x6f, 0x6e, 0x67, 0x7a, 0x65, 0x72, 0x40, 0x32, 0x30, 0x32, 0x30, 0x6e, 0x6f, 0x2e, 0x31}
 )
 
 var (
-	aesIV = []byte{0x49, 0x56, 0x20, 0x66, 0x6f, 0x72, 0x20, 0x3c, 0x53, 0x4d, 0x32, 0x3e, 0x20, 0x43, 0x54, 0x52} //"IV for <SM2> CTR"
-	uid   = []byte{0x72, 0x6f, 0x6e, 0x67, 0x7a, 0x65, 0x72, 0x40, 0x32, 0x30, 0x32, 0x30, 0x6e, 0x6f, 0x2e, 0x31}
-	uLen  = []byte{0x0, 0x80}
+	// DefaultID is the signer ID recommended by GM/T 0009 and used by default
+	// in most other SM2 implementations.
+	DefaultID = []byte("1234567812345678")
+	// LegacyID is the signer ID hashed by Sign and Verify. As the ID of
+	// SignWithID, VerifyWithID, CalculateDigest or SignerOpts it also selects
+	// their Z value, which writes the coordinates of the public key without
+	// leading zeros, so that the signatures always match those of Sign.
+	LegacyID = []byte("rongzer@2020no.1")
 )
 
 var one = new(big.Int).SetInt64(1)
@@ -48,37 +61,206 @@ func randFieldElement(c elliptic.Curve, rand io.Reader) (*big.Int, error) {
 	return k, nil
 }
 
-// Combine the raw data with user ID, curve parameters and public key
-// to generate the signed data used in Sign and Verify
-func getZ(msg []byte, pub *ecdsa.PublicKey, h hash.Hash) ([]byte, error) {
+// computeZ returns Z = SM3(ENTL || ID || a || b || xG || yG || xA || yA) for
+// the user ID and public key, as defined in GB/T 32918.2. For LegacyID it
+// returns the Z of getZ instead.
+func computeZ(id []byte, pub *ecdsa.PublicKey, h hash.Hash) ([]byte, error) {
 	if pub == nil {
 		return nil, errors.New("public key should not be nil")
 	}
-	c, ok := pub.Curve.(curve)
-	if !ok {
+	if _, ok := pub.Curve.(curve); !ok {
 		return nil, errors.New("the curve type is not SM2Curve")
 	}
+	if len(id) >= 1<<13 {
+		return nil, errors.New("the user ID is too long")
+	}
+	if !validCoordinates(pub) {
+		return nil, errors.New("invalid public key")
+	}
+	var buf [32]byte
+	writeZ(h, &buf, id, pub)
+	return h.Sum(nil), nil
+}
 
+// writeZ resets h and writes the input of the Z of computeZ to it, encoding
+// the integers in buf so that it does not allocate. pub must be on the SM2
+// curve with coordinates of at most 256 bits.
+func writeZ(h hash.Hash, buf *[32]byte, id []byte, pub *ecdsa.PublicKey) {
+	legacy := bytes.Equal(id, uid)
+	entl := len(id) << 3
+	buf[0], buf[1] = byte(entl>>8), byte(entl)
 	h.Reset()
-	h.Write(uLen)
-	h.Write(uid)
-	h.Write(c.ABytes())
-	h.Write(c.Params().B.Bytes())
-	h.Write(c.Params().Gx.Bytes())
-	h.Write(c.Params().Gy.Bytes())
-	h.Write(pub.X.Bytes())
-	h.Write(pub.Y.Bytes())
-	return append(h.Sum(nil), msg...), nil
+	h.Write(buf[:2])
+	h.Write(id)
+	h.Write(sm2Curve.a)
+	for _, n := range [...]*big.Int{sm2Curve.B, sm2Curve.Gx, sm2Curve.Gy, pub.X, pub.Y} {
+		var limbs [4]uint64
+		fromBig(limbs[:], n)
+		sm2LittleToBig(buf[:], limbs[:])
+		i := 0
+		for legacy && i < len(buf) && buf[i] == 0 {
+			i++
+		}
+		h.Write(buf[i:])
+	}
 }
 
-// fromBig converts a *big.Int into a format used by this code.
-func fromBig(out []uint64, big *big.Int) {
-	for i := range out {
-		out[i] = 0
+// CalculateDigest returns e = SM3(Z || msg), the value actually signed by
+// SM2, with Z computed from the signer ID and the public key. It can be
+// passed to SignDigest, VerifyDigest or PrivateKey.Sign with Digest set.
+func CalculateDigest(pub *ecdsa.PublicKey, msg, id []byte) ([]byte, error) {
+	h := sm3.New()
+	z, err := computeZ(id, pub, h)
+	if err != nil {
+		return nil, err
 	}
+	h.Reset()
+	h.Write(z)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Combine the raw data with user ID, curve parameters and public key
+// to generate the signed data used in Sign and Verify.
+//
+// It always hashes LegacyID and, unlike the Z of other IDs, writes the
+// coordinates of the public key without leading zeros. Both are kept so that
+// signatures made by earlier versions still verify.
+func getZ(msg []byte, pub *ecdsa.PublicKey, h hash.Hash) ([]byte, error) {
+	z, err := computeZ(uid, pub, h)
+	if err != nil {
+		return nil, err
+	}
+	return append(z, msg...), nil
+}
+
+// scalarBytes sets out to the 32 bytes big-endian encoding of k < 2^256.
+// Unlike toBytes it goes through fixed-size limbs, so that encoding a secret
+// scalar does not depend on its number of leading zeros.
+func scalarBytes(out *[32]byte, k *big.Int) {
+	var limbs [4]uint64
+	fromBig(limbs[:], k)
+	sm2LittleToBig(out[:], limbs[:])
+}
+
+// scalarFromBytes sets k to the 32 bytes big-endian b and reports whether it
+// is a valid nonce in [1, n-1]. Other values are rejected rather than
+// reduced, so that only the rejection, which says nothing about the nonce
+// finally used, depends on the value.
+func scalarFromBytes(k *[4]uint64, b []byte) bool {
+	sm2BigToLittle(k[:], b)
+	return *k != [4]uint64{} && lessThan(k, &sm2Ord)
+}
 
-	for i, v := range big.Bits() {
-		out[i] = uint64(v)
+// toBytes returns the 32 bytes big-endian encoding of a field element or
+// scalar, left padded with zeros.
+func toBytes(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) >= 32 {
+		return b
+	}
+	out := make([]byte, 32)
+	copy(out[32-len(b):], b)
+	return out
+}
+
+// marshalPoint encodes a point of the SM2 curve in the uncompressed form
+// 04||x||y, or in the compressed form 02/03||x when compress is true.
+func marshalPoint(x, y *big.Int, compress bool) []byte {
+	if compress {
+		out := make([]byte, 1, 33)
+		out[0] = byte(2 + y.Bit(0))
+		return append(out, toBytes(x)...)
+	}
+	out := make([]byte, 1, 65)
+	out[0] = 4
+	out = append(out, toBytes(x)...)
+	return append(out, toBytes(y)...)
+}
+
+// unmarshalPoint decodes an uncompressed, compressed or hybrid point of the
+// SM2 curve from the start of data, and returns the number of bytes it used.
+// The point is checked to be on the curve.
+func unmarshalPoint(data []byte) (x, y *big.Int, n int, err error) {
+	if len(data) == 0 {
+		return nil, nil, 0, errors.New("invalid point encoding")
+	}
+	switch data[0] {
+	case 2, 3:
+		n = 33
+	case 4, 6, 7:
+		n = 65
+	default:
+		return nil, nil, 0, errors.New("invalid point encoding")
+	}
+	if len(data) < n {
+		return nil, nil, 0, errors.New("invalid point encoding")
+	}
+
+	params := sm2Curve.Params()
+	x = new(big.Int).SetBytes(data[1:33])
+	if x.Cmp(params.P) >= 0 {
+		return nil, nil, 0, errors.New("invalid point encoding")
+	}
+	if n == 33 {
+		// y² = x³ - 3x + b
+		y2 := new(big.Int).Mul(x, x)
+		y2.Mul(y2, x)
+		x3 := new(big.Int).Lsh(x, 1)
+		x3.Add(x3, x)
+		y2.Sub(y2, x3)
+		y2.Add(y2, params.B)
+		y2.Mod(y2, params.P)
+		y = sqrtModP(y2)
+		if y == nil {
+			return nil, nil, 0, errors.New("invalid point encoding")
+		}
+		if y.Bit(0) != uint(data[0]&1) {
+			y.Sub(params.P, y)
+		}
+	} else {
+		y = new(big.Int).SetBytes(data[33:65])
+		if data[0] != 4 && y.Bit(0) != uint(data[0]&1) {
+			return nil, nil, 0, errors.New("invalid point encoding")
+		}
+	}
+	if y.Cmp(params.P) >= 0 || !sm2Curve.IsOnCurve(x, y) {
+		return nil, nil, 0, errors.New("point is not on the curve")
+	}
+	return x, y, n, nil
+}
+
+// sqrtModP returns a square root of a mod P, or nil if a is not a square.
+func sqrtModP(a *big.Int) *big.Int {
+	in := make([]uint64, 4)
+	fromBig(in, a)
+	sm2Mul(in, in, rr0)
+	root := make([]uint64, 4)
+	if !sm2Sqrt(root, in) {
+		return nil
+	}
+	sm2FromMont(root, root)
+	out := make([]byte, 32)
+	sm2LittleToBig(out, root)
+	return new(big.Int).SetBytes(out)
+}
+
+// fromBig converts a *big.Int into a format used by this code.
+//
+// The words of in are first copied to a fixed-size buffer, so that the loop
+// does not depend on how many leading zero words in leaves out.
+func fromBig(out []uint64, in *big.Int) {
+	var words [8]big.Word
+	copy(words[:], in.Bits())
+
+	// big.Word is only 32 bits wide on some platforms, in which case two
+	// words make up each limb.
+	for i := range out {
+		if bits.UintSize == 64 {
+			out[i] = uint64(words[i])
+		} else {
+			out[i] = uint64(words[2*i]) | uint64(words[2*i+1])<<32
+		}
 	}
 }
 
@@ -420,6 +602,71 @@ func sm2Inverse(out, in []uint64) {
 	sm2Mul(out, out, in)
 }
 
+// sm2Sqrt sets out to a square root of in, both in the Montgomery domain, and
+// reports whether in is a square. out must not alias in. As p = 3 mod 4 the root is in^((p+1)/4),
+// where (p+1)/4 has the bits
+//
+//	1^31 0 1^128 0^31 1 0^62
+//
+// from the most significant down.
+func sm2Sqrt(out, in []uint64) bool {
+	var stack [6 * 4]uint64
+	t := stack[4*0 : 4*0+4]
+	x2 := stack[4*1 : 4*1+4]
+	x4 := stack[4*2 : 4*2+4]
+	x8 := stack[4*3 : 4*3+4]
+	x16 := stack[4*4 : 4*4+4]
+	x32 := stack[4*5 : 4*5+4]
+
+	// xN = in^(2^N - 1)
+	sqrN := func(out, in []uint64, n int) {
+		copy(out, in)
+		for i := 0; i < n; i++ {
+			sm2Sqr(out, out)
+		}
+	}
+	sqrN(t, in, 1)
+	sm2Mul(x2, t, in)
+	sqrN(t, x2, 2)
+	sm2Mul(x4, t, x2)
+	sqrN(t, x4, 4)
+	sm2Mul(x8, t, x4)
+	sqrN(t, x8, 8)
+	sm2Mul(x16, t, x8)
+	sqrN(t, x16, 16)
+	sm2Mul(x32, t, x16)
+
+	// in^(2^31 - 1), from x16 through 24, 28, 30 and 31 bits
+	acc := make([]uint64, 4)
+	sqrN(acc, x16, 8)
+	sm2Mul(acc, acc, x8)
+	sqrN(acc, acc, 4)
+	sm2Mul(acc, acc, x4)
+	sqrN(acc, acc, 2)
+	sm2Mul(acc, acc, x2)
+	sqrN(acc, acc, 1)
+	sm2Mul(acc, acc, in)
+
+	sqrN(acc, acc, 1)
+	for i := 0; i < 4; i++ {
+		sqrN(acc, acc, 32)
+		sm2Mul(acc, acc, x32)
+	}
+	sqrN(acc, acc, 32)
+	sm2Mul(acc, acc, in)
+	sqrN(out, acc, 62)
+
+	// Check out² = in, comparing the canonical values.
+	sm2Sqr(t, out)
+	sm2FromMont(x4, t)
+	sm2FromMont(x8, in)
+	var d uint64
+	for i := range x4 {
+		d |= x4[i] ^ x8[i]
+	}
+	return d == 0
+}
+
 func boothW5(in uint) (int, int) {
 	var s = ^((in >> 5) - 1)
 	var d = (1 << 6) - in - 1
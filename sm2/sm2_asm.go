@@ -8,46 +8,70 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
+
+//go:build amd64 && !purego
+// +build amd64,!purego
+
 package sm2
 
-// Functions implemented in asm_amd64.s
+// Functions implemented in sm2_asm_amd64.s
 // Montgomery multiplication modulo P256
+//go:noescape
 func sm2Mul(res, in1, in2 []uint64)
 
 // Montgomery square modulo P256
+//go:noescape
 func sm2Sqr(res, in []uint64)
 
 // Montgomery multiplication by 1
+//go:noescape
 func sm2FromMont(res, in []uint64)
 
 // iff cond == 1  val <- -val
+//go:noescape
 func sm2NegCond(val []uint64, cond int)
 
 // if cond == 0 res <- b; else res <- a
+//go:noescape
 func sm2MovCond(res, a, b []uint64, cond int)
 
 // Endianness swap
+//go:noescape
 func sm2BigToLittle(res []uint64, in []byte)
+//go:noescape
 func sm2LittleToBig(res []byte, in []uint64)
 
 // Constant time table access
+//go:noescape
 func sm2Select(point, table []uint64, idx int)
+//go:noescape
 func sm2SelectBase(point, table []uint64, idx int)
 
 // Montgomery multiplication modulo Ord(G)
+//go:noescape
 func sm2OrdMul(res, in1, in2 []uint64)
 
-// Montgomery square modulo Ord(G), repeated n times
-func sm2OrdSqr(res, in []uint64, n int)
+// Montgomery square modulo Ord(G), repeated n times. The squaring routine
+// inherited from the P256 assembly relies on the shape of that curve's
+// order, so it is built on sm2OrdMul instead.
+func sm2OrdSqr(res, in []uint64, n int) {
+	copy(res[:4], in[:4])
+	for i := 0; i < n; i++ {
+		sm2OrdMul(res, res, res)
+	}
+}
 
 // Point add with in2 being affine point
 // If sign == 1 -> in2 = -in2
 // If sel == 0 -> res = in1
 // if zero == 0 -> res = in2
+//go:noescape
 func sm2PointAddAffineAsm(res, in1, in2 []uint64, sign, sel, zero int)
 
 // Point add
+//go:noescape
 func sm2PointAddAsm(res, in1, in2 []uint64)
 
 // Point double
+//go:noescape
 func sm2PointDoubleAsm(res, in []uint64)
@@ -8,6 +8,10 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
+
+//go:build !purego
+// +build !purego
+
 #include "textflag.h"
 
 #define res_ptr DI
@@ -87,18 +91,14 @@ TEXT ·sm2MovCond(SB),NOSPLIT,$0
 	PSHUFD $0, X12, X12
 	PCMPEQL X13, X12
 
-	MOVOU X12, X0
-	PANDN (16*0)(x_ptr), X0
-	MOVOU X12, X1
-	PANDN (16*1)(x_ptr), X1
-	MOVOU X12, X2
-	PANDN (16*2)(x_ptr), X2
-	MOVOU X12, X3
-	PANDN (16*3)(x_ptr), X3
-	MOVOU X12, X4
-	PANDN (16*4)(x_ptr), X4
-	MOVOU X12, X5
-	PANDN (16*5)(x_ptr), X5
+	// res = a ^ ((a ^ b) & mask), with unaligned loads since the
+	// operands may live on the stack.
+	MOVOU (16*0)(x_ptr), X0
+	MOVOU (16*1)(x_ptr), X1
+	MOVOU (16*2)(x_ptr), X2
+	MOVOU (16*3)(x_ptr), X3
+	MOVOU (16*4)(x_ptr), X4
+	MOVOU (16*5)(x_ptr), X5
 
 	MOVOU (16*0)(y_ptr), X6
 	MOVOU (16*1)(y_ptr), X7
@@ -107,6 +107,13 @@ TEXT ·sm2MovCond(SB),NOSPLIT,$0
 	MOVOU (16*4)(y_ptr), X10
 	MOVOU (16*5)(y_ptr), X11
 
+	PXOR X0, X6
+	PXOR X1, X7
+	PXOR X2, X8
+	PXOR X3, X9
+	PXOR X4, X10
+	PXOR X5, X11
+
 	PAND X12, X6
 	PAND X12, X7
 	PAND X12, X8
@@ -1127,244 +1134,6 @@ TEXT ·sm2OrdMul(SB),NOSPLIT,$0
 
 	RET
 /* ---------------------------------------*/
-// func sm2OrdSqr(res, in []uint64, n int)
-TEXT ·sm2OrdSqr(SB),NOSPLIT,$0
-	MOVQ res+0(FP), res_ptr
-	MOVQ in+24(FP), x_ptr
-	MOVQ n+48(FP), BX
-
-ordSqrLoop:
-
-	// y[1:] * y[0]
-	MOVQ (8*0)(x_ptr), t0
-
-	MOVQ (8*1)(x_ptr), AX
-	MULQ t0
-	MOVQ AX, acc1
-	MOVQ DX, acc2
-
-	MOVQ (8*2)(x_ptr), AX
-	MULQ t0
-	ADDQ AX, acc2
-	ADCQ $0, DX
-	MOVQ DX, acc3
-
-	MOVQ (8*3)(x_ptr), AX
-	MULQ t0
-	ADDQ AX, acc3
-	ADCQ $0, DX
-	MOVQ DX, acc4
-	// y[2:] * y[1]
-	MOVQ (8*1)(x_ptr), t0
-
-	MOVQ (8*2)(x_ptr), AX
-	MULQ t0
-	ADDQ AX, acc3
-	ADCQ $0, DX
-	MOVQ DX, t1
-
-	MOVQ (8*3)(x_ptr), AX
-	MULQ t0
-	ADDQ t1, acc4
-	ADCQ $0, DX
-	ADDQ AX, acc4
-	ADCQ $0, DX
-	MOVQ DX, acc5
-	// y[3] * y[2]
-	MOVQ (8*2)(x_ptr), t0
-
-	MOVQ (8*3)(x_ptr), AX
-	MULQ t0
-	ADDQ AX, acc5
-	ADCQ $0, DX
-	MOVQ DX, y_ptr
-	XORQ t1, t1
-	// *2
-	ADDQ acc1, acc1
-	ADCQ acc2, acc2
-	ADCQ acc3, acc3
-	ADCQ acc4, acc4
-	ADCQ acc5, acc5
-	ADCQ y_ptr, y_ptr
-	ADCQ $0, t1
-	// Missing products
-	MOVQ (8*0)(x_ptr), AX
-	MULQ AX
-	MOVQ AX, acc0
-	MOVQ DX, t0
-
-	MOVQ (8*1)(x_ptr), AX
-	MULQ AX
-	ADDQ t0, acc1
-	ADCQ AX, acc2
-	ADCQ $0, DX
-	MOVQ DX, t0
-
-	MOVQ (8*2)(x_ptr), AX
-	MULQ AX
-	ADDQ t0, acc3
-	ADCQ AX, acc4
-	ADCQ $0, DX
-	MOVQ DX, t0
-
-	MOVQ (8*3)(x_ptr), AX
-	MULQ AX
-	ADDQ t0, acc5
-	ADCQ AX, y_ptr
-	ADCQ DX, t1
-	MOVQ t1, x_ptr
-	// First reduction step
-	MOVQ acc0, AX
-	MULQ sm2ordK0<>(SB)
-	MOVQ AX, t0
-
-	MOVQ sm2ord<>+0x00(SB), AX
-	MULQ t0
-	ADDQ AX, acc0
-	ADCQ $0, DX
-	MOVQ DX, t1
-
-	MOVQ sm2ord<>+0x08(SB), AX
-	MULQ t0
-	ADDQ t1, acc1
-	ADCQ $0, DX
-	ADDQ AX, acc1
-
-	MOVQ t0, t1
-	ADCQ DX, acc2
-	ADCQ $0, t1
-	SUBQ t0, acc2
-	SBBQ $0, t1
-
-	MOVQ sm2ord<>+0x18(SB), AX
-	ADDQ t1, acc3
-	ADCQ $0, DX
-	ADDQ AX, acc3
-	ADCQ $0, DX
-	MOVQ DX, acc0
-	// Second reduction step
-	MOVQ acc1, AX
-	MULQ sm2ordK0<>(SB)
-	MOVQ AX, t0
-
-	MOVQ sm2ord<>+0x00(SB), AX
-	MULQ t0
-	ADDQ AX, acc1
-	ADCQ $0, DX
-	MOVQ DX, t1
-
-	MOVQ sm2ord<>+0x08(SB), AX
-	MULQ t0
-	ADDQ t1, acc2
-	ADCQ $0, DX
-	ADDQ AX, acc2
-
-	MOVQ t0, t1
-	ADCQ DX, acc3
-	ADCQ $0, t1
-	SUBQ t0, acc3
-	SBBQ $0, t1
-
-	MOVQ sm2ord<>+0x18(SB), AX
-	ADDQ t1, acc0
-	ADCQ $0, DX
-	ADDQ AX, acc0
-	ADCQ $0, DX
-	MOVQ DX, acc1
-	// Third reduction step
-	MOVQ acc2, AX
-	MULQ sm2ordK0<>(SB)
-	MOVQ AX, t0
-
-	MOVQ sm2ord<>+0x00(SB), AX
-	MULQ t0
-	ADDQ AX, acc2
-	ADCQ $0, DX
-	MOVQ DX, t1
-
-	MOVQ sm2ord<>+0x08(SB), AX
-	MULQ t0
-	ADDQ t1, acc3
-	ADCQ $0, DX
-	ADDQ AX, acc3
-
-	MOVQ t0, t1
-	ADCQ DX, acc0
-	ADCQ $0, t1
-	SUBQ t0, acc0
-	SBBQ $0, t1
-
-	MOVQ sm2ord<>+0x18(SB), AX
-	ADDQ t1, acc1
-	ADCQ $0, DX
-	ADDQ AX, acc1
-	ADCQ $0, DX
-	MOVQ DX, acc2
-	// Last reduction step
-	MOVQ acc3, AX
-	MULQ sm2ordK0<>(SB)
-	MOVQ AX, t0
-
-	MOVQ sm2ord<>+0x00(SB), AX
-	MULQ t0
-	ADDQ AX, acc3
-	ADCQ $0, DX
-	MOVQ DX, t1
-
-	MOVQ sm2ord<>+0x08(SB), AX
-	MULQ t0
-	ADDQ t1, acc0
-	ADCQ $0, DX
-	ADDQ AX, acc0
-	ADCQ $0, DX
-	MOVQ DX, t1
-
-	MOVQ t0, t1
-	ADCQ DX, acc1
-	ADCQ $0, t1
-	SUBQ t0, acc1
-	SBBQ $0, t1
-
-	MOVQ sm2ord<>+0x18(SB), AX
-	ADDQ t1, acc2
-	ADCQ $0, DX
-	ADDQ AX, acc2
-	ADCQ $0, DX
-	MOVQ DX, acc3
-	XORQ t0, t0
-	// Add bits [511:256] of the sqr result
-	ADCQ acc4, acc0
-	ADCQ acc5, acc1
-	ADCQ y_ptr, acc2
-	ADCQ x_ptr, acc3
-	ADCQ $0, t0
-
-	MOVQ acc0, acc4
-	MOVQ acc1, acc5
-	MOVQ acc2, y_ptr
-	MOVQ acc3, t1
-	// Subtract sm2
-	SUBQ sm2ord<>+0x00(SB), acc0
-	SBBQ sm2ord<>+0x08(SB) ,acc1
-	SBBQ sm2ord<>+0x10(SB), acc2
-	SBBQ sm2ord<>+0x18(SB), acc3
-	SBBQ $0, t0
-
-	CMOVQCS acc4, acc0
-	CMOVQCS acc5, acc1
-	CMOVQCS y_ptr, acc2
-	CMOVQCS t1, acc3
-
-	MOVQ acc0, (8*0)(res_ptr)
-	MOVQ acc1, (8*1)(res_ptr)
-	MOVQ acc2, (8*2)(res_ptr)
-	MOVQ acc3, (8*3)(res_ptr)
-	MOVQ res_ptr, x_ptr
-	DECQ BX
-	JNE ordSqrLoop
-
-	RET
-/* ---------------------------------------*/
 #undef res_ptr
 #undef x_ptr
 #undef y_ptr
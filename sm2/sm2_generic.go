@@ -0,0 +1,395 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Portable implementations of the routines in sm2_asm_amd64.s. They are
+// always compiled so that they can be checked against the assembly, and are
+// wired up as the real implementation by sm2_noasm.go on every other
+// platform or when building with the purego tag.
+//
+// All field elements are four little-endian 64-bit limbs and every routine
+// keeps its results fully reduced, exactly like the assembly, so both paths
+// produce bit-identical outputs. None of them branch on or index memory by
+// their inputs.
+
+var (
+	sm2Prime = [4]uint64{0xFFFFFFFFFFFFFFFF, 0xFFFFFFFF00000000, 0xFFFFFFFFFFFFFFFF, 0xFFFFFFFEFFFFFFFF}
+	sm2Ord   = [4]uint64{0x53BBF40939D54123, 0x7203DF6B21C6052B, 0xFFFFFFFFFFFFFFFF, 0xFFFFFFFEFFFFFFFF}
+	sm2One   = [4]uint64{0x0000000000000001, 0x00000000FFFFFFFF, 0x0000000000000000, 0x0000000100000000}
+)
+
+const (
+	// -p^-1 mod 2^64 and -n^-1 mod 2^64
+	sm2PrimeK0 = 0x0000000000000001
+	sm2OrdK0   = 0x327F9E8872350975
+)
+
+// ctMask returns all ones if cond != 0 and zero otherwise.
+func ctMask(cond int) uint64 {
+	c := uint64(cond)
+	return -((c | -c) >> 63)
+}
+
+// ctEqMask returns all ones if a == b and zero otherwise.
+func ctEqMask(a, b int) uint64 {
+	return ^ctMask(a ^ b)
+}
+
+// lessThan reports whether a < b.
+func lessThan(a, b *[4]uint64) bool {
+	var borrow uint64
+	_, borrow = bits.Sub64(a[0], b[0], 0)
+	_, borrow = bits.Sub64(a[1], b[1], borrow)
+	_, borrow = bits.Sub64(a[2], b[2], borrow)
+	_, borrow = bits.Sub64(a[3], b[3], borrow)
+	return borrow == 1
+}
+
+// reduceOnce sets res = t mod m for t < 2m, where t is given as four limbs
+// plus a carry word.
+func reduceOnce(res []uint64, t *[4]uint64, carry uint64, m *[4]uint64) {
+	var s [4]uint64
+	var b uint64
+	s[0], b = bits.Sub64(t[0], m[0], 0)
+	s[1], b = bits.Sub64(t[1], m[1], b)
+	s[2], b = bits.Sub64(t[2], m[2], b)
+	s[3], b = bits.Sub64(t[3], m[3], b)
+	_, b = bits.Sub64(carry, 0, b)
+
+	// If the subtraction borrowed, t was already reduced.
+	mask := -b
+	res[0] = t[0]&mask | s[0]&^mask
+	res[1] = t[1]&mask | s[1]&^mask
+	res[2] = t[2]&mask | s[2]&^mask
+	res[3] = t[3]&mask | s[3]&^mask
+}
+
+// montMul sets res = in1 * in2 * 2^-256 mod m using word-by-word Montgomery
+// reduction, k0 being -m^-1 mod 2^64.
+func montMul(res, in1, in2 []uint64, m *[4]uint64, k0 uint64) {
+	var t [4]uint64
+	var t4, t5 uint64
+	for i := 0; i < 4; i++ {
+		var c, cc, hi, lo uint64
+		b := in2[i]
+		for j := 0; j < 4; j++ {
+			hi, lo = bits.Mul64(in1[j], b)
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j], c = lo, hi
+		}
+		t4, t5 = bits.Add64(t4, c, 0)
+
+		u := t[0] * k0
+		hi, lo = bits.Mul64(u, m[0])
+		_, cc = bits.Add64(lo, t[0], 0)
+		c = hi + cc
+		for j := 1; j < 4; j++ {
+			hi, lo = bits.Mul64(u, m[j])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j-1], c = lo, hi
+		}
+		t[3], cc = bits.Add64(t4, c, 0)
+		t4 = t5 + cc
+	}
+	reduceOnce(res, &t, t4, m)
+}
+
+// sm2MulGeneric is the portable version of sm2Mul.
+func sm2MulGeneric(res, in1, in2 []uint64) {
+	montMul(res, in1, in2, &sm2Prime, sm2PrimeK0)
+}
+
+// sm2SqrGeneric is the portable version of sm2Sqr.
+func sm2SqrGeneric(res, in []uint64) {
+	montMul(res, in, in, &sm2Prime, sm2PrimeK0)
+}
+
+// sm2FromMontGeneric is the portable version of sm2FromMont.
+func sm2FromMontGeneric(res, in []uint64) {
+	one := [4]uint64{1, 0, 0, 0}
+	montMul(res, in, one[:], &sm2Prime, sm2PrimeK0)
+}
+
+// sm2OrdMulGeneric is the portable version of sm2OrdMul.
+func sm2OrdMulGeneric(res, in1, in2 []uint64) {
+	montMul(res, in1, in2, &sm2Ord, sm2OrdK0)
+}
+
+// sm2OrdSqrGeneric is the portable version of sm2OrdSqr.
+func sm2OrdSqrGeneric(res, in []uint64, n int) {
+	copy(res[:4], in[:4])
+	for i := 0; i < n; i++ {
+		montMul(res, res, res, &sm2Ord, sm2OrdK0)
+	}
+}
+
+// sm2NegCondGeneric is the portable version of sm2NegCond. Like the assembly
+// it computes p - val without a final reduction.
+func sm2NegCondGeneric(val []uint64, cond int) {
+	var t [4]uint64
+	var b uint64
+	t[0], b = bits.Sub64(sm2Prime[0], val[0], 0)
+	t[1], b = bits.Sub64(sm2Prime[1], val[1], b)
+	t[2], b = bits.Sub64(sm2Prime[2], val[2], b)
+	t[3], _ = bits.Sub64(sm2Prime[3], val[3], b)
+
+	mask := ctMask(cond)
+	val[0] = t[0]&mask | val[0]&^mask
+	val[1] = t[1]&mask | val[1]&^mask
+	val[2] = t[2]&mask | val[2]&^mask
+	val[3] = t[3]&mask | val[3]&^mask
+}
+
+// sm2MovCondGeneric is the portable version of sm2MovCond.
+func sm2MovCondGeneric(res, a, b []uint64, cond int) {
+	mask := ctMask(cond)
+	for i := 0; i < 12; i++ {
+		res[i] = a[i]&mask | b[i]&^mask
+	}
+}
+
+// sm2BigToLittleGeneric is the portable version of sm2BigToLittle.
+func sm2BigToLittleGeneric(res []uint64, in []byte) {
+	res[0] = binary.BigEndian.Uint64(in[24:32])
+	res[1] = binary.BigEndian.Uint64(in[16:24])
+	res[2] = binary.BigEndian.Uint64(in[8:16])
+	res[3] = binary.BigEndian.Uint64(in[0:8])
+}
+
+// sm2LittleToBigGeneric is the portable version of sm2LittleToBig.
+func sm2LittleToBigGeneric(res []byte, in []uint64) {
+	binary.BigEndian.PutUint64(res[0:8], in[3])
+	binary.BigEndian.PutUint64(res[8:16], in[2])
+	binary.BigEndian.PutUint64(res[16:24], in[1])
+	binary.BigEndian.PutUint64(res[24:32], in[0])
+}
+
+// sm2SelectGeneric is the portable version of sm2Select. It reads all 16
+// Jacobian points of the table regardless of idx.
+func sm2SelectGeneric(point, table []uint64, idx int) {
+	var acc [12]uint64
+	for i := 0; i < 16; i++ {
+		mask := ctEqMask(i+1, idx)
+		for j := 0; j < 12; j++ {
+			acc[j] |= table[i*12+j] & mask
+		}
+	}
+	copy(point[:12], acc[:])
+}
+
+// sm2SelectBaseGeneric is the portable version of sm2SelectBase. It reads
+// all 64 affine points of the table regardless of idx.
+func sm2SelectBaseGeneric(point, table []uint64, idx int) {
+	var acc [8]uint64
+	for i := 0; i < 64; i++ {
+		mask := ctEqMask(i+1, idx)
+		for j := 0; j < 8; j++ {
+			acc[j] |= table[i*8+j] & mask
+		}
+	}
+	copy(point[:8], acc[:])
+}
+
+// sm2Add sets res = a + b mod p.
+func sm2Add(res, a, b []uint64) {
+	addMod(res, a, b, &sm2Prime)
+}
+
+// sm2Sub sets res = a - b mod p.
+func sm2Sub(res, a, b []uint64) {
+	subMod(res, a, b, &sm2Prime)
+}
+
+// sm2OrdAdd sets res = a + b mod n.
+func sm2OrdAdd(res, a, b []uint64) {
+	addMod(res, a, b, &sm2Ord)
+}
+
+// sm2OrdSub sets res = a - b mod n.
+func sm2OrdSub(res, a, b []uint64) {
+	subMod(res, a, b, &sm2Ord)
+}
+
+// addMod sets res = a + b mod m for a, b < m.
+func addMod(res, a, b []uint64, m *[4]uint64) {
+	var t [4]uint64
+	var c uint64
+	t[0], c = bits.Add64(a[0], b[0], 0)
+	t[1], c = bits.Add64(a[1], b[1], c)
+	t[2], c = bits.Add64(a[2], b[2], c)
+	t[3], c = bits.Add64(a[3], b[3], c)
+	reduceOnce(res, &t, c, m)
+}
+
+// subMod sets res = a - b mod m for a, b < m.
+func subMod(res, a, b []uint64, m *[4]uint64) {
+	var t [4]uint64
+	var c uint64
+	t[0], c = bits.Sub64(a[0], b[0], 0)
+	t[1], c = bits.Sub64(a[1], b[1], c)
+	t[2], c = bits.Sub64(a[2], b[2], c)
+	t[3], c = bits.Sub64(a[3], b[3], c)
+
+	mask := -c
+	res[0], c = bits.Add64(t[0], m[0]&mask, 0)
+	res[1], c = bits.Add64(t[1], m[1]&mask, c)
+	res[2], c = bits.Add64(t[2], m[2]&mask, c)
+	res[3], _ = bits.Add64(t[3], m[3]&mask, c)
+}
+
+// sm2Half sets res = a / 2 mod p.
+func sm2Half(res, a []uint64) {
+	var t [4]uint64
+	var c uint64
+	mask := -(a[0] & 1)
+	t[0], c = bits.Add64(a[0], sm2Prime[0]&mask, 0)
+	t[1], c = bits.Add64(a[1], sm2Prime[1]&mask, c)
+	t[2], c = bits.Add64(a[2], sm2Prime[2]&mask, c)
+	t[3], c = bits.Add64(a[3], sm2Prime[3]&mask, c)
+
+	res[0] = t[0]>>1 | t[1]<<63
+	res[1] = t[1]>>1 | t[2]<<63
+	res[2] = t[2]>>1 | t[3]<<63
+	res[3] = t[3]>>1 | c<<63
+}
+
+// sm2PointAddAffineGeneric is the portable version of sm2PointAddAffineAsm.
+// It follows the same sequence of field operations as the assembly.
+func sm2PointAddAffineGeneric(res, in1, in2 []uint64, sign, sel, zero int) {
+	var z1sqr, h, r, s2, rsqr, hsqr, hcub, t, y2 [4]uint64
+	var out [12]uint64
+	x1, y1, z1 := in1[0:4], in1[4:8], in1[8:12]
+	x2 := in2[0:4]
+
+	copy(y2[:], in2[4:8])
+	sm2NegCondGeneric(y2[:], sign)
+
+	sm2SqrGeneric(z1sqr[:], z1)        // z1ˆ2
+	sm2MulGeneric(t[:], z1sqr[:], x2)  // u2 = x2 * z1ˆ2
+	sm2Sub(h[:], t[:], x1)             // h = u2 - u1
+	sm2MulGeneric(out[8:12], h[:], z1) // z3 = h * z1
+
+	sm2MulGeneric(t[:], z1sqr[:], z1)     // z1ˆ3
+	sm2MulGeneric(s2[:], t[:], y2[:])     // s2 = y2 * z1ˆ3
+	sm2Sub(r[:], s2[:], y1)               // r = s2 - s1
+	sm2SqrGeneric(rsqr[:], r[:])          // rsqr = rˆ2
+	sm2SqrGeneric(hsqr[:], h[:])          // hsqr = hˆ2
+	sm2MulGeneric(hcub[:], hsqr[:], h[:]) // hcub = hˆ3
+	sm2MulGeneric(s2[:], hcub[:], y1)     // y1 * hˆ3
+	sm2MulGeneric(h[:], x1, hsqr[:])      // u1 * hˆ2
+
+	sm2Add(t[:], h[:], h[:])    // u1 * hˆ2 * 2
+	sm2Sub(t[:], rsqr[:], t[:]) // rˆ2 - u1 * hˆ2 * 2
+	sm2Sub(out[0:4], t[:], hcub[:])
+
+	sm2Sub(t[:], h[:], out[0:4])
+	sm2MulGeneric(t[:], t[:], r[:])
+	sm2Sub(out[4:8], t[:], s2[:])
+
+	// The result is not valid if (sel == 0), conditional choose
+	mask := ctMask(sel)
+	for i := 0; i < 12; i++ {
+		out[i] = out[i]&mask | in1[i]&^mask
+	}
+	// Similarly if zero == 0
+	mask = ctMask(zero)
+	for i := 0; i < 4; i++ {
+		out[i] = out[i]&mask | x2[i]&^mask
+		out[4+i] = out[4+i]&mask | y2[i]&^mask
+		out[8+i] = out[8+i]&mask | sm2One[i]&^mask
+	}
+	copy(res[:12], out[:])
+}
+
+// sm2PointAddGeneric is the portable version of sm2PointAddAsm. Like the
+// assembly it does not handle in1 == in2 or either input at infinity.
+func sm2PointAddGeneric(res, in1, in2 []uint64) {
+	var z1sqr, z2sqr, u1, u2, s1, s2, h, r, rsqr, hsqr, hcub, t [4]uint64
+	var out [12]uint64
+	x1, y1, z1 := in1[0:4], in1[4:8], in1[8:12]
+	x2, y2, z2 := in2[0:4], in2[4:8], in2[8:12]
+
+	sm2SqrGeneric(z2sqr[:], z2)           // z2ˆ2
+	sm2MulGeneric(t[:], z2sqr[:], z2)     // z2ˆ3
+	sm2MulGeneric(s1[:], t[:], y1)        // s1 = z2ˆ3*y1
+	sm2SqrGeneric(z1sqr[:], z1)           // z1ˆ2
+	sm2MulGeneric(t[:], z1sqr[:], z1)     // z1ˆ3
+	sm2MulGeneric(s2[:], t[:], y2)        // s2 = z1ˆ3*y2
+	sm2Sub(r[:], s2[:], s1[:])            // r = s2 - s1
+	sm2MulGeneric(u1[:], z2sqr[:], x1)    // u1 = x1 * z2ˆ2
+	sm2MulGeneric(u2[:], z1sqr[:], x2)    // u2 = x2 * z1ˆ2
+	sm2Sub(h[:], u2[:], u1[:])            // h = u2 - u1
+	sm2SqrGeneric(rsqr[:], r[:])          // rsqr = rˆ2
+	sm2SqrGeneric(hsqr[:], h[:])          // hsqr = hˆ2
+	sm2MulGeneric(hcub[:], hsqr[:], h[:]) // hcub = hˆ3
+	sm2MulGeneric(s2[:], hcub[:], s1[:])
+
+	sm2MulGeneric(t[:], z1, z2)          // z1 * z2
+	sm2MulGeneric(out[8:12], t[:], h[:]) // z1 * z2 * h
+	sm2MulGeneric(u2[:], hsqr[:], u1[:]) // hˆ2 * u1
+
+	sm2Add(t[:], u2[:], u2[:])  // u1 * hˆ2 * 2
+	sm2Sub(t[:], rsqr[:], t[:]) // rˆ2 - u1 * hˆ2 * 2
+	sm2Sub(out[0:4], t[:], hcub[:])
+
+	sm2Sub(t[:], u2[:], out[0:4])
+	sm2MulGeneric(t[:], t[:], r[:])
+	sm2Sub(out[4:8], t[:], s2[:])
+
+	copy(res[:12], out[:])
+}
+
+// sm2PointDoubleGeneric is the portable version of sm2PointDoubleAsm.
+func sm2PointDoubleGeneric(res, in []uint64) {
+	var zsqr, m, s, y, t [4]uint64
+	var out [12]uint64
+	x, z := in[0:4], in[8:12]
+
+	sm2SqrGeneric(zsqr[:], z)
+	sm2Add(m[:], x, zsqr[:])
+
+	sm2MulGeneric(t[:], z, in[4:8])
+	sm2Add(out[8:12], t[:], t[:])
+
+	sm2Sub(t[:], x, zsqr[:])
+	sm2MulGeneric(m[:], t[:], m[:])
+	// Multiply by 3
+	sm2Add(t[:], m[:], m[:])
+	sm2Add(m[:], m[:], t[:])
+
+	sm2Add(t[:], in[4:8], in[4:8])
+	sm2SqrGeneric(s[:], t[:])
+	sm2SqrGeneric(t[:], s[:])
+	// Divide by 2
+	sm2Half(y[:], t[:])
+
+	sm2MulGeneric(s[:], x, s[:])
+	sm2Add(t[:], s[:], s[:])
+	sm2SqrGeneric(out[0:4], m[:])
+	sm2Sub(out[0:4], out[0:4], t[:])
+
+	sm2Sub(t[:], s[:], out[0:4])
+	sm2MulGeneric(t[:], t[:], m[:])
+	sm2Sub(out[4:8], t[:], y[:])
+
+	copy(res[:12], out[:])
+}
@@ -0,0 +1,269 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+// The tests below compare the portable routines with the ones the package is
+// built with. On amd64 without the purego tag that is the assembly, so they
+// prove both paths are bit-for-bit identical.
+
+func randLimbs(t *testing.T, m *big.Int) []uint64 {
+	k, err := rand.Int(rand.Reader, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]uint64, 4)
+	fromBig(out, k)
+	return out
+}
+
+func limbsToBig(in []uint64) *big.Int {
+	b := make([]byte, 32)
+	sm2LittleToBigGeneric(b, in)
+	return new(big.Int).SetBytes(b)
+}
+
+func equalLimbs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// randJacobian returns a random point in Jacobian coordinates whose Z is not
+// one, in the Montgomery domain.
+func randJacobian(t *testing.T) []uint64 {
+	var p point
+	k := randLimbs(t, sm2Curve.N)
+	p.baseMult(k)
+	sm2PointDoubleAsm(p.xyz[:], p.xyz[:])
+	return p.xyz[:]
+}
+
+func TestGenericFieldArithmetic(t *testing.T) {
+	rInv := new(big.Int).Lsh(one, 256)
+	rInv.ModInverse(rInv, sm2Curve.P)
+	rInvN := new(big.Int).Lsh(one, 256)
+	rInvN.ModInverse(rInvN, sm2Curve.N)
+
+	got := make([]uint64, 4)
+	want := make([]uint64, 4)
+	for i := 0; i < 1000; i++ {
+		a, b := randLimbs(t, sm2Curve.P), randLimbs(t, sm2Curve.P)
+
+		sm2MulGeneric(got, a, b)
+		sm2Mul(want, a, b)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2Mul(%x, %x) = %x, want %x", a, b, got, want)
+		}
+		ref := new(big.Int).Mul(limbsToBig(a), limbsToBig(b))
+		ref.Mul(ref, rInv)
+		ref.Mod(ref, sm2Curve.P)
+		if limbsToBig(got).Cmp(ref) != 0 {
+			t.Fatalf("sm2MulGeneric(%x, %x) = %x, want %x", a, b, got, ref)
+		}
+
+		sm2SqrGeneric(got, a)
+		sm2Sqr(want, a)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2Sqr(%x) = %x, want %x", a, got, want)
+		}
+
+		sm2FromMontGeneric(got, a)
+		sm2FromMont(want, a)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2FromMont(%x) = %x, want %x", a, got, want)
+		}
+
+		for cond := 0; cond < 2; cond++ {
+			copy(got, a)
+			copy(want, a)
+			sm2NegCondGeneric(got, cond)
+			sm2NegCond(want, cond)
+			if !equalLimbs(got, want) {
+				t.Fatalf("sm2NegCond(%x, %d) = %x, want %x", a, cond, got, want)
+			}
+		}
+
+		a, b = randLimbs(t, sm2Curve.N), randLimbs(t, sm2Curve.N)
+		sm2OrdMulGeneric(got, a, b)
+		sm2OrdMul(want, a, b)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2OrdMul(%x, %x) = %x, want %x", a, b, got, want)
+		}
+		ref = new(big.Int).Mul(limbsToBig(a), limbsToBig(b))
+		ref.Mul(ref, rInvN)
+		ref.Mod(ref, sm2Curve.N)
+		if limbsToBig(got).Cmp(ref) != 0 {
+			t.Fatalf("sm2OrdMulGeneric(%x, %x) = %x, want %x", a, b, got, ref)
+		}
+
+		n := i%8 + 1
+		sm2OrdSqrGeneric(got, a, n)
+		sm2OrdSqr(want, a, n)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2OrdSqr(%x, %d) = %x, want %x", a, n, got, want)
+		}
+
+		sm2OrdAdd(got, a, b)
+		ref = new(big.Int).Add(limbsToBig(a), limbsToBig(b))
+		if limbsToBig(got).Cmp(ref.Mod(ref, sm2Curve.N)) != 0 {
+			t.Fatalf("sm2OrdAdd(%x, %x) = %x, want %x", a, b, got, ref)
+		}
+		sm2OrdSub(got, a, b)
+		ref = new(big.Int).Sub(limbsToBig(a), limbsToBig(b))
+		if limbsToBig(got).Cmp(ref.Mod(ref, sm2Curve.N)) != 0 {
+			t.Fatalf("sm2OrdSub(%x, %x) = %x, want %x", a, b, got, ref)
+		}
+
+		bGot, bWant := make([]byte, 32), make([]byte, 32)
+		sm2LittleToBigGeneric(bGot, a)
+		sm2LittleToBig(bWant, a)
+		if string(bGot) != string(bWant) {
+			t.Fatalf("sm2LittleToBig(%x) = %x, want %x", a, bGot, bWant)
+		}
+		sm2BigToLittleGeneric(got, bGot)
+		sm2BigToLittle(want, bWant)
+		if !equalLimbs(got, want) || !equalLimbs(got, a) {
+			t.Fatalf("sm2BigToLittle(%x) = %x, want %x", bGot, got, want)
+		}
+	}
+}
+
+func TestGenericTableAccess(t *testing.T) {
+	table := make([]uint64, 16*12)
+	for i := 0; i < 16; i++ {
+		copy(table[i*12:], randJacobian(t))
+	}
+	got, want := make([]uint64, 12), make([]uint64, 12)
+	for idx := 0; idx <= 16; idx++ {
+		sm2SelectGeneric(got, table, idx)
+		sm2Select(want, table, idx)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2Select(%d) = %x, want %x", idx, got, want)
+		}
+	}
+
+	for i := 0; i < 37; i++ {
+		for idx := 0; idx <= 64; idx++ {
+			sm2SelectBaseGeneric(got[:8], sm2Precomputed[i][:], idx)
+			sm2SelectBase(want[:8], sm2Precomputed[i][:], idx)
+			if !equalLimbs(got[:8], want[:8]) {
+				t.Fatalf("sm2SelectBase(%d, %d) = %x, want %x", i, idx, got[:8], want[:8])
+			}
+		}
+	}
+
+	a, b := randJacobian(t), randJacobian(t)
+	for cond := 0; cond < 2; cond++ {
+		sm2MovCondGeneric(got, a, b, cond)
+		sm2MovCond(want, a, b, cond)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2MovCond(%d) = %x, want %x", cond, got, want)
+		}
+	}
+}
+
+func TestGenericPointArithmetic(t *testing.T) {
+	got, want := make([]uint64, 12), make([]uint64, 12)
+	for i := 0; i < 200; i++ {
+		a, b := randJacobian(t), randJacobian(t)
+
+		sm2PointDoubleGeneric(got, a)
+		sm2PointDoubleAsm(want, a)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2PointDouble(%x) = %x, want %x", a, got, want)
+		}
+
+		sm2PointAddGeneric(got, a, b)
+		sm2PointAddAsm(want, a, b)
+		if !equalLimbs(got, want) {
+			t.Fatalf("sm2PointAdd(%x, %x) = %x, want %x", a, b, got, want)
+		}
+
+		affine := sm2Precomputed[i%37][(i%64)*8 : (i%64)*8+8]
+		for sign := 0; sign < 2; sign++ {
+			for sel := 0; sel < 2; sel++ {
+				for zero := 0; zero < 2; zero++ {
+					sm2PointAddAffineGeneric(got, a, affine, sign, sel, zero)
+					sm2PointAddAffineAsm(want, a, affine, sign, sel, zero)
+					if !equalLimbs(got, want) {
+						t.Fatalf("sm2PointAddAffine(%d, %d, %d) = %x, want %x", sign, sel, zero, got, want)
+					}
+				}
+			}
+		}
+	}
+
+	// The routines must also cope with the output aliasing an input.
+	a, b := randJacobian(t), randJacobian(t)
+	sm2PointAddAsm(want, a, b)
+	copy(got, a)
+	sm2PointAddGeneric(got, got, b)
+	if !equalLimbs(got, want) {
+		t.Fatalf("aliased sm2PointAdd = %x, want %x", got, want)
+	}
+}
+
+func TestCurveMatchesGeneric(t *testing.T) {
+	params := sm2Curve.Params()
+	for i := 0; i < 20; i++ {
+		k1, _ := rand.Int(rand.Reader, params.N)
+		k2, _ := rand.Int(rand.Reader, params.N)
+
+		x, y := sm2Curve.ScalarBaseMult(k1.Bytes())
+		wx, wy := params.ScalarBaseMult(k1.Bytes())
+		if x.Cmp(wx) != 0 || y.Cmp(wy) != 0 {
+			t.Fatalf("ScalarBaseMult(%x) = (%x, %x), want (%x, %x)", k1, x, y, wx, wy)
+		}
+		if !params.IsOnCurve(x, y) {
+			t.Fatalf("ScalarBaseMult(%x) is not on the curve", k1)
+		}
+
+		x2, y2 := sm2Curve.ScalarMult(x, y, k2.Bytes())
+		wx2, wy2 := params.ScalarMult(x, y, k2.Bytes())
+		if x2.Cmp(wx2) != 0 || y2.Cmp(wy2) != 0 {
+			t.Fatalf("ScalarMult(%x) = (%x, %x), want (%x, %x)", k2, x2, y2, wx2, wy2)
+		}
+
+		x3, y3 := sm2Curve.CombinedMult(x, y, k2.Bytes(), k1.Bytes())
+		bx, by := params.ScalarBaseMult(k2.Bytes())
+		px, py := params.ScalarMult(x, y, k1.Bytes())
+		wx3, wy3 := params.Add(bx, by, px, py)
+		if x3.Cmp(wx3) != 0 || y3.Cmp(wy3) != 0 {
+			t.Fatalf("CombinedMult = (%x, %x), want (%x, %x)", x3, y3, wx3, wy3)
+		}
+	}
+}
+
+func TestInverse(t *testing.T) {
+	N := sm2Curve.Params().N
+	for i := 0; i < 100; i++ {
+		k, _ := rand.Int(rand.Reader, N)
+		if k.Sign() == 0 {
+			continue
+		}
+		inv := sm2Curve.Inverse(k)
+		if want := new(big.Int).ModInverse(k, N); inv.Cmp(want) != 0 {
+			t.Fatalf("Inverse(%x) = %x, want %x", k, inv, want)
+		}
+	}
+}
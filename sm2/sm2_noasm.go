@@ -0,0 +1,59 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !amd64 || purego
+// +build !amd64 purego
+
+package sm2
+
+// Functions implemented in sm2_generic.go
+// Montgomery multiplication modulo P256
+func sm2Mul(res, in1, in2 []uint64) { sm2MulGeneric(res, in1, in2) }
+
+// Montgomery square modulo P256
+func sm2Sqr(res, in []uint64) { sm2SqrGeneric(res, in) }
+
+// Montgomery multiplication by 1
+func sm2FromMont(res, in []uint64) { sm2FromMontGeneric(res, in) }
+
+// iff cond == 1  val <- -val
+func sm2NegCond(val []uint64, cond int) { sm2NegCondGeneric(val, cond) }
+
+// if cond == 0 res <- b; else res <- a
+func sm2MovCond(res, a, b []uint64, cond int) { sm2MovCondGeneric(res, a, b, cond) }
+
+// Endianness swap
+func sm2BigToLittle(res []uint64, in []byte) { sm2BigToLittleGeneric(res, in) }
+func sm2LittleToBig(res []byte, in []uint64) { sm2LittleToBigGeneric(res, in) }
+
+// Constant time table access
+func sm2Select(point, table []uint64, idx int)     { sm2SelectGeneric(point, table, idx) }
+func sm2SelectBase(point, table []uint64, idx int) { sm2SelectBaseGeneric(point, table, idx) }
+
+// Montgomery multiplication modulo Ord(G)
+func sm2OrdMul(res, in1, in2 []uint64) { sm2OrdMulGeneric(res, in1, in2) }
+
+// Montgomery square modulo Ord(G), repeated n times
+func sm2OrdSqr(res, in []uint64, n int) { sm2OrdSqrGeneric(res, in, n) }
+
+// Point add with in2 being affine point
+// If sign == 1 -> in2 = -in2
+// If sel == 0 -> res = in1
+// if zero == 0 -> res = in2
+func sm2PointAddAffineAsm(res, in1, in2 []uint64, sign, sel, zero int) {
+	sm2PointAddAffineGeneric(res, in1, in2, sign, sel, zero)
+}
+
+// Point add
+func sm2PointAddAsm(res, in1, in2 []uint64) { sm2PointAddGeneric(res, in1, in2) }
+
+// Point double
+func sm2PointDoubleAsm(res, in []uint64) { sm2PointDoubleGeneric(res, in) }
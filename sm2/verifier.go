@@ -0,0 +1,110 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/rongzer/gm/sm3"
+)
+
+// Verifier checks signatures of a single public key faster than Verify, for
+// keys that verify many signatures such as those of validators or CAs. It
+// caches the Z value of the key and a table of multiples of the key, so
+// that [t]P is computed with the fixed-base method used for [s]G. The table
+// takes about 150 KB and costs about as much to build as twenty
+// verifications. A Verifier is safe for concurrent use.
+type Verifier struct {
+	pub   *ecdsa.PublicKey
+	z     []byte
+	table *[37][64 * 8]uint64
+}
+
+// NewVerifier returns a Verifier for pub whose Verify method hashes the
+// message like the Verify function, with LegacyID.
+func NewVerifier(pub *ecdsa.PublicKey) (*Verifier, error) {
+	if err := checkVerifierKey(pub); err != nil {
+		return nil, err
+	}
+	mz, err := getZ(nil, pub, sm3.New())
+	if err != nil {
+		return nil, err
+	}
+	return newVerifier(pub, mz), nil
+}
+
+// NewVerifierWithID is like NewVerifier, but the Verify method hashes the
+// message with id, like VerifyWithID.
+func NewVerifierWithID(pub *ecdsa.PublicKey, id []byte) (*Verifier, error) {
+	if err := checkVerifierKey(pub); err != nil {
+		return nil, err
+	}
+	z, err := computeZ(id, pub, sm3.New())
+	if err != nil {
+		return nil, err
+	}
+	return newVerifier(pub, z), nil
+}
+
+func checkVerifierKey(pub *ecdsa.PublicKey) error {
+	if pub == nil {
+		return errors.New("public key should not be nil")
+	}
+	if _, ok := pub.Curve.(curve); !ok {
+		return errors.New("the curve type is not SM2Curve")
+	}
+	if pub.X == nil || pub.Y == nil || !sm2Curve.IsOnCurve(pub.X, pub.Y) {
+		return errors.New("point is not on the curve")
+	}
+	return nil
+}
+
+func newVerifier(pub *ecdsa.PublicKey, z []byte) *Verifier {
+	var p [8]uint64
+	fromBig(p[0:4], pub.X)
+	fromBig(p[4:8], pub.Y)
+	sm2Mul(p[0:4], p[0:4], rr0[:])
+	sm2Mul(p[4:8], p[4:8], rr0[:])
+	return &Verifier{pub: pub, z: z, table: precomputeTable(p[:])}
+}
+
+// PublicKey returns the public key of v.
+func (v *Verifier) PublicKey() *ecdsa.PublicKey {
+	return v.pub
+}
+
+// Verify reports whether r, s is a valid signature of msg by the public key
+// of v.
+func (v *Verifier) Verify(msg []byte, r, s *big.Int) bool {
+	h := sm3.New()
+	h.Write(v.z)
+	h.Write(msg)
+	return v.VerifyDigest(h.Sum(nil), r, s)
+}
+
+// VerifyDigest is like the VerifyDigest function, for the public key of v.
+func (v *Verifier) VerifyDigest(digest []byte, r, s *big.Int) bool {
+	t, ok := signatureT(r, s)
+	if !ok {
+		return false
+	}
+
+	var scalar [4]uint64
+	var r1, r2 point
+	p256GetScalar(scalar[:], s.Bytes())
+	r1.baseMult(scalar[:])
+	p256GetScalar(scalar[:], t.Bytes())
+	r2.tableMult(v.table, scalar[:])
+	sm2PointAddAsm(r1.xyz[:], r1.xyz[:], r2.xyz[:])
+	return r1.hasX(r, digest)
+}
@@ -0,0 +1,171 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestVerifier(t *testing.T) {
+	priv, _ := GenerateKey()
+	v, err := NewVerifier(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.PublicKey() != &priv.PublicKey {
+		t.Error("PublicKey returned another key")
+	}
+	other, _ := GenerateKey()
+	for i := 0; i < 20; i++ {
+		msg := make([]byte, i*10)
+		rand.Read(msg)
+		r, s, err := Sign(priv, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.Verify(msg, r, s) {
+			t.Errorf("#%d: verification failed", i)
+		}
+		if v.Verify(append(msg, 0), r, s) {
+			t.Errorf("#%d: verification of another message succeeded", i)
+		}
+		if v.Verify(msg, s, r) {
+			t.Errorf("#%d: verification of swapped r and s succeeded", i)
+		}
+		r, s, _ = Sign(other, msg)
+		if v.Verify(msg, r, s) {
+			t.Errorf("#%d: verification of a signature by another key succeeded", i)
+		}
+	}
+
+	for _, rs := range [][2]*big.Int{
+		{big.NewInt(0), big.NewInt(1)},
+		{big.NewInt(1), big.NewInt(0)},
+		{sm2Curve.N, big.NewInt(1)},
+		{big.NewInt(1), new(big.Int).Sub(sm2Curve.N, big.NewInt(1))},
+	} {
+		if v.VerifyDigest(make([]byte, 32), rs[0], rs[1]) {
+			t.Errorf("verification of r = %v, s = %v succeeded", rs[0], rs[1])
+		}
+	}
+}
+
+func TestVerifierWithIDOpenSSL(t *testing.T) {
+	pub := &testKey().PublicKey
+	for i, test := range opensslSignatureTests {
+		v, err := NewVerifierWithID(pub, test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _ := new(big.Int).SetString(test.r, 16)
+		s, _ := new(big.Int).SetString(test.s, 16)
+		if !v.Verify([]byte("message digest"), r, s) {
+			t.Errorf("#%d: verification failed", i)
+		}
+		if v.Verify([]byte("message digesT"), r, s) {
+			t.Errorf("#%d: verification of another message succeeded", i)
+		}
+	}
+}
+
+func TestVerifierMatchesVerifyDigest(t *testing.T) {
+	priv, _ := GenerateKey()
+	v, _ := NewVerifier(&priv.PublicKey)
+	for i := 0; i < 50; i++ {
+		digest := make([]byte, 32)
+		rand.Read(digest)
+		r, s, _ := SignDigest(priv, digest, rand.Reader)
+		if i%2 == 1 {
+			s, _ = rand.Int(rand.Reader, sm2Curve.N)
+		}
+		if got, want := v.VerifyDigest(digest, r, s), VerifyDigest(&priv.PublicKey, digest, r, s); got != want {
+			t.Errorf("#%d: Verifier.VerifyDigest = %v, VerifyDigest = %v", i, got, want)
+		}
+	}
+}
+
+func TestTableMult(t *testing.T) {
+	priv, _ := GenerateKey()
+	v, _ := NewVerifier(&priv.PublicKey)
+	scalars := []*big.Int{
+		big.NewInt(1),
+		big.NewInt(64),
+		new(big.Int).Lsh(big.NewInt(1), 252),
+		new(big.Int).Sub(sm2Curve.N, big.NewInt(1)),
+	}
+	for i := 0; i < 10; i++ {
+		k, _ := rand.Int(rand.Reader, sm2Curve.N)
+		scalars = append(scalars, k)
+	}
+	for _, k := range scalars {
+		var scalar [4]uint64
+		var p point
+		p256GetScalar(scalar[:], k.Bytes())
+		p.tableMult(v.table, scalar[:])
+		x, y := p.pointToAffine()
+		wantX, wantY := sm2Curve.ScalarMult(priv.X, priv.Y, k.Bytes())
+		if x.Cmp(wantX) != 0 || y.Cmp(wantY) != 0 {
+			t.Errorf("[%x]P = (%x, %x), want (%x, %x)", k, x, y, wantX, wantY)
+		}
+	}
+}
+
+func TestNewVerifierErrors(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	priv, _ := GenerateKey()
+	for _, pub := range []*ecdsa.PublicKey{
+		nil,
+		&p256.PublicKey,
+		{Curve: sm2Curve, X: priv.X, Y: new(big.Int).Add(priv.Y, big.NewInt(1))},
+		{Curve: sm2Curve},
+	} {
+		if _, err := NewVerifier(pub); err == nil {
+			t.Errorf("NewVerifier(%v) succeeded", pub)
+		}
+		if _, err := NewVerifierWithID(pub, DefaultID); err == nil {
+			t.Errorf("NewVerifierWithID(%v) succeeded", pub)
+		}
+	}
+}
+
+func BenchmarkVerifier(b *testing.B) {
+	msg := make([]byte, 256)
+	rand.Read(msg)
+	priv, _ := GenerateKey()
+	r, s, _ := Sign(priv, msg)
+
+	b.Run("Verify", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Verify(&priv.PublicKey, msg, r, s)
+		}
+	})
+
+	b.Run("Verifier", func(b *testing.B) {
+		v, _ := NewVerifier(&priv.PublicKey)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			v.Verify(msg, r, s)
+		}
+	})
+
+	b.Run("NewVerifier", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewVerifier(&priv.PublicKey)
+		}
+	})
+}
@@ -0,0 +1,409 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package x509
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rongzer/gm/sm2"
+	"github.com/rongzer/gm/sm3"
+)
+
+// An SM2 root and leaf issued with OpenSSL 3 using
+// "-sigopt distid:1234567812345678".
+const (
+	opensslRootPEM = `-----BEGIN CERTIFICATE-----
+MIIBwTCCAWegAwIBAgIBATAKBggqgRzPVQGDdTBHMQswCQYDVQQGEwJDTjEVMBMG
+A1UECgwMUm9uZ3plciBUZXN0MSEwHwYDVQQDDBhSb25nemVyIFRlc3QgU00yIFJv
+b3QgQ0EwIBcNMjYxMDE4MTE0MTU1WhgPMjEyNjA5MjQxMTQxNTVaMEcxCzAJBgNV
+BAYTAkNOMRUwEwYDVQQKDAxSb25nemVyIFRlc3QxITAfBgNVBAMMGFJvbmd6ZXIg
+VGVzdCBTTTIgUm9vdCBDQTBZMBMGByqGSM49AgEGCCqBHM9VAYItA0IABFSD7s0s
+mu3bJFk+mHFGAncA7OCCyPxaojadGsU8F3FwZHR764j6lzutsGdDC0BN2X6YFpYl
+KsZyP91sPV9TdV2jQjBAMA8GA1UdEwEB/wQFMAMBAf8wDgYDVR0PAQH/BAQDAgEG
+MB0GA1UdDgQWBBSiOtnpwcxVNb2o6YyqXYuwY6lLujAKBggqgRzPVQGDdQNIADBF
+AiEAgXZY7cmtw8QYc0GelnakcztqZqDK8pd5zXsBbcMuBSQCIFCyR378tGPg4wx+
+ENA3Xd0KMLKAAQgo0eq9LHrlTs9k
+-----END CERTIFICATE-----
+`
+	opensslLeafPEM = `-----BEGIN CERTIFICATE-----
+MIIC/jCCAqWgAwIBAgICEjQwCgYIKoEcz1UBg3UwRzELMAkGA1UEBhMCQ04xFTAT
+BgNVBAoMDFJvbmd6ZXIgVGVzdDEhMB8GA1UEAwwYUm9uZ3plciBUZXN0IFNNMiBS
+b290IENBMCAXDTI2MTAxODExNDE1NVoYDzIxMjYwOTI0MTE0MTU1WjA9MQswCQYD
+VQQGEwJDTjEVMBMGA1UECgwMUm9uZ3plciBUZXN0MRcwFQYDVQQDDA5nbS5leGFt
+cGxlLmNvbTBZMBMGByqGSM49AgEGCCqBHM9VAYItA0IABOZ2BRmtbnjAv7hvyP6z
+gsBssswPul7tQbXnBARBFJud1zkIz45t59kbTmeZBpWhMGp52UjstH+OJH/Lj+BF
+/XajggGHMIIBgzAMBgNVHRMBAf8EAjAAMA4GA1UdDwEB/wQEAwIFoDAdBgNVHSUE
+FjAUBggrBgEFBQcDAQYIKwYBBQUHAwIwXwYDVR0RBFgwVoIOZ20uZXhhbXBsZS5j
+b22CECouZ20uZXhhbXBsZS5jb22HBH8AAAGBEWFkbWluQGV4YW1wbGUuY29thhlo
+dHRwczovL2dtLmV4YW1wbGUuY29tL2lkMB0GA1UdDgQWBBSRd+fwTehwOkQaY9PI
+0TGwUSZ2YzAfBgNVHSMEGDAWgBSiOtnpwcxVNb2o6YyqXYuwY6lLujAwBgNVHR8E
+KTAnMCWgI6Ahhh9odHRwOi8vY3JsLmV4YW1wbGUuY29tL3Jvb3QuY3JsMF8GCCsG
+AQUFBwEBBFMwUTAjBggrBgEFBQcwAYYXaHR0cDovL29jc3AuZXhhbXBsZS5jb20w
+KgYIKwYBBQUHMAKGHmh0dHA6Ly9jYS5leGFtcGxlLmNvbS9yb290LmNlcjAQBgNV
+HSAECTAHMAUGAyoDBDAKBggqgRzPVQGDdQNHADBEAiBhCreTVvxcO5dGUpiob95D
+AZVOFRdaWyBeb0blDb1MQwIgIIBoYEWC61lezayC6+H53Zrz2TbrtZ+GK1Yl1Pfk
+Pio=
+-----END CERTIFICATE-----
+`
+)
+
+func mustParseCertificate(t *testing.T, s string) *Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		t.Fatal("failed to decode PEM")
+	}
+	cert, err := ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestParseCertificate(t *testing.T) {
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+
+	if root.SignatureAlgorithm != SM2WithSM3 || leaf.SignatureAlgorithm != SM2WithSM3 {
+		t.Errorf("signature algorithms = %v, %v, want SM2-SM3", root.SignatureAlgorithm, leaf.SignatureAlgorithm)
+	}
+	if root.PublicKeyAlgorithm != SM2 || leaf.PublicKeyAlgorithm != SM2 {
+		t.Errorf("public key algorithms = %v, %v, want SM2", root.PublicKeyAlgorithm, leaf.PublicKeyAlgorithm)
+	}
+	if _, ok := leaf.PublicKey.(*sm2.PublicKey); !ok {
+		t.Fatalf("leaf public key is %T, want *sm2.PublicKey", leaf.PublicKey)
+	}
+
+	if root.Subject.CommonName != "Rongzer Test SM2 Root CA" || !bytes.Equal(root.RawSubject, root.RawIssuer) {
+		t.Errorf("unexpected root subject %v", root.Subject)
+	}
+	if !root.BasicConstraintsValid || !root.IsCA {
+		t.Error("root is not a CA")
+	}
+	if root.KeyUsage != KeyUsageCertSign|KeyUsageCRLSign {
+		t.Errorf("root key usage = %x", root.KeyUsage)
+	}
+
+	if leaf.Version != 3 || leaf.SerialNumber.Cmp(big.NewInt(0x1234)) != 0 {
+		t.Errorf("leaf version %d, serial %v", leaf.Version, leaf.SerialNumber)
+	}
+	if leaf.Subject.CommonName != "gm.example.com" || leaf.Issuer.CommonName != root.Subject.CommonName {
+		t.Errorf("leaf subject %v, issuer %v", leaf.Subject, leaf.Issuer)
+	}
+	if !leaf.BasicConstraintsValid || leaf.IsCA {
+		t.Error("leaf should have CA:FALSE")
+	}
+	if leaf.KeyUsage != KeyUsageDigitalSignature|KeyUsageKeyEncipherment {
+		t.Errorf("leaf key usage = %x", leaf.KeyUsage)
+	}
+	if len(leaf.ExtKeyUsage) != 2 || leaf.ExtKeyUsage[0] != ExtKeyUsageServerAuth || leaf.ExtKeyUsage[1] != ExtKeyUsageClientAuth {
+		t.Errorf("leaf ext key usage = %v", leaf.ExtKeyUsage)
+	}
+	if len(leaf.DNSNames) != 2 || leaf.DNSNames[0] != "gm.example.com" || leaf.DNSNames[1] != "*.gm.example.com" {
+		t.Errorf("leaf DNS names = %v", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("leaf IP addresses = %v", leaf.IPAddresses)
+	}
+	if len(leaf.EmailAddresses) != 1 || leaf.EmailAddresses[0] != "admin@example.com" {
+		t.Errorf("leaf email addresses = %v", leaf.EmailAddresses)
+	}
+	if len(leaf.URIs) != 1 || leaf.URIs[0].String() != "https://gm.example.com/id" {
+		t.Errorf("leaf URIs = %v", leaf.URIs)
+	}
+	if !bytes.Equal(leaf.AuthorityKeyId, root.SubjectKeyId) {
+		t.Errorf("leaf AKI %x does not match root SKI %x", leaf.AuthorityKeyId, root.SubjectKeyId)
+	}
+	if want, _ := hex.DecodeString("9177e7f04de8703a441a63d3c8d131b051267663"); !bytes.Equal(leaf.SubjectKeyId, want) {
+		t.Errorf("leaf SKI = %x", leaf.SubjectKeyId)
+	}
+	if len(leaf.CRLDistributionPoints) != 1 || leaf.CRLDistributionPoints[0] != "http://crl.example.com/root.crl" {
+		t.Errorf("leaf CRL distribution points = %v", leaf.CRLDistributionPoints)
+	}
+	if len(leaf.OCSPServer) != 1 || leaf.OCSPServer[0] != "http://ocsp.example.com" {
+		t.Errorf("leaf OCSP servers = %v", leaf.OCSPServer)
+	}
+	if len(leaf.IssuingCertificateURL) != 1 || leaf.IssuingCertificateURL[0] != "http://ca.example.com/root.cer" {
+		t.Errorf("leaf issuing certificate URLs = %v", leaf.IssuingCertificateURL)
+	}
+	if len(leaf.PolicyIdentifiers) != 1 || !leaf.PolicyIdentifiers[0].Equal(asn1.ObjectIdentifier{1, 2, 3, 4}) {
+		t.Errorf("leaf policies = %v", leaf.PolicyIdentifiers)
+	}
+	if len(leaf.UnhandledCriticalExtensions) != 0 {
+		t.Errorf("unhandled critical extensions: %v", leaf.UnhandledCriticalExtensions)
+	}
+}
+
+func TestParseCertificates(t *testing.T) {
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+
+	certs, err := ParseCertificates(append(append([]byte{}, leaf.Raw...), root.Raw...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(leaf) || !certs[1].Equal(root) {
+		t.Fatal("ParseCertificates returned unexpected certificates")
+	}
+
+	if _, err := ParseCertificate(append(append([]byte{}, leaf.Raw...), 0)); err == nil {
+		t.Error("ParseCertificate accepted trailing data")
+	}
+}
+
+func TestCertificateCheckSignatureFrom(t *testing.T) {
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+
+	if err := root.CheckSignatureFrom(root); err != nil {
+		t.Errorf("root self-signature: %v", err)
+	}
+	if err := leaf.CheckSignatureFrom(root); err != nil {
+		t.Errorf("leaf signature: %v", err)
+	}
+	if err := root.CheckSignatureFrom(leaf); err == nil {
+		t.Error("a non-CA certificate was accepted as issuer")
+	} else if _, ok := err.(ConstraintViolationError); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	tampered := *leaf
+	tampered.Signature = append([]byte{}, leaf.Signature...)
+	tampered.Signature[len(tampered.Signature)-1] ^= 1
+	if err := tampered.CheckSignatureFrom(root); err == nil {
+		t.Error("tampered signature verified")
+	}
+
+	tampered = *leaf
+	tampered.RawTBSCertificate = append([]byte{}, leaf.RawTBSCertificate...)
+	tampered.RawTBSCertificate[len(tampered.RawTBSCertificate)-1] ^= 1
+	if err := tampered.CheckSignatureFrom(root); err == nil {
+		t.Error("tampered certificate verified")
+	}
+}
+
+func TestCreateCertificate(t *testing.T) {
+	caKey, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Unix(1600000000, 0).UTC()
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "SM2 Root", Organization: []string{"Rongzer"}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		PermittedDNSDomains:   []string{".example.com"},
+		ExcludedIPRanges:      []*net.IPNet{{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)}},
+	}
+	caDER, err := CreateCertificate(caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caTemplate.SubjectKeyId) != 0 {
+		t.Error("CreateCertificate modified the template")
+	}
+	ca, err := ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("self-signed certificate: %v", err)
+	}
+	spki := sm2.Marshal(caKey.X, caKey.Y)
+	if h := sm3.SumSM3(spki); !bytes.Equal(ca.SubjectKeyId, h[:20]) {
+		t.Errorf("SubjectKeyId = %x, want leftmost 160 bits of SM3 of the public key", ca.SubjectKeyId)
+	}
+	if len(ca.AuthorityKeyId) != 0 {
+		t.Errorf("self-signed certificate has AuthorityKeyId %x", ca.AuthorityKeyId)
+	}
+	if !ca.IsCA || ca.MaxPathLen != 0 || !ca.MaxPathLenZero {
+		t.Errorf("basic constraints IsCA=%v MaxPathLen=%d", ca.IsCA, ca.MaxPathLen)
+	}
+	if len(ca.PermittedDNSDomains) != 1 || ca.PermittedDNSDomains[0] != ".example.com" ||
+		len(ca.ExcludedIPRanges) != 1 || ca.ExcludedIPRanges[0].String() != "192.168.0.0/16" {
+		t.Errorf("name constraints %v %v", ca.PermittedDNSDomains, ca.ExcludedIPRanges)
+	}
+
+	uri, _ := url.Parse("https://gm.example.com/id")
+	leafTemplate := &Certificate{
+		SerialNumber:          big.NewInt(0x1234),
+		Subject:               pkix.Name{CommonName: "gm.example.com"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(365 * 24 * time.Hour),
+		KeyUsage:              KeyUsageDigitalSignature | KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []ExtKeyUsage{ExtKeyUsageServerAuth},
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{{1, 2, 3, 5}},
+		BasicConstraintsValid: true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+		DNSNames:              []string{"gm.example.com"},
+		EmailAddresses:        []string{"admin@example.com"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.ParseIP("2001:db8::1")},
+		URIs:                  []*url.URL{uri},
+		OCSPServer:            []string{"http://ocsp.example.com"},
+		IssuingCertificateURL: []string{"http://ca.example.com/root.cer"},
+		CRLDistributionPoints: []string{"http://crl.example.com/root.crl"},
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+		ExtraExtensions:       []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 6}, Value: []byte{5, 0}}},
+	}
+	leafDER, err := CreateCertificate(leafTemplate, ca, &leafKey.PublicKey, caKey.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("leaf signature: %v", err)
+	}
+	if leaf.SignatureAlgorithm != SM2WithSM3 || leaf.PublicKeyAlgorithm != SM2 {
+		t.Errorf("algorithms %v, %v", leaf.SignatureAlgorithm, leaf.PublicKeyAlgorithm)
+	}
+	if !leafKey.Public().(*sm2.PublicKey).Equal(leaf.PublicKey) {
+		t.Error("leaf public key mismatch")
+	}
+	if !bytes.Equal(leaf.RawIssuer, ca.RawSubject) || leaf.Subject.CommonName != "gm.example.com" {
+		t.Errorf("issuer %v, subject %v", leaf.Issuer, leaf.Subject)
+	}
+	if !leaf.NotBefore.Equal(leafTemplate.NotBefore) || !leaf.NotAfter.Equal(leafTemplate.NotAfter) {
+		t.Errorf("validity %v - %v", leaf.NotBefore, leaf.NotAfter)
+	}
+	if !bytes.Equal(leaf.SubjectKeyId, leafTemplate.SubjectKeyId) || !bytes.Equal(leaf.AuthorityKeyId, ca.SubjectKeyId) {
+		t.Errorf("SubjectKeyId %x, AuthorityKeyId %x", leaf.SubjectKeyId, leaf.AuthorityKeyId)
+	}
+	if leaf.IsCA || leaf.KeyUsage != leafTemplate.KeyUsage {
+		t.Errorf("IsCA %v, KeyUsage %x", leaf.IsCA, leaf.KeyUsage)
+	}
+	if len(leaf.ExtKeyUsage) != 1 || leaf.ExtKeyUsage[0] != ExtKeyUsageServerAuth ||
+		len(leaf.UnknownExtKeyUsage) != 1 || !leaf.UnknownExtKeyUsage[0].Equal(asn1.ObjectIdentifier{1, 2, 3, 5}) {
+		t.Errorf("ExtKeyUsage %v, UnknownExtKeyUsage %v", leaf.ExtKeyUsage, leaf.UnknownExtKeyUsage)
+	}
+	if len(leaf.IPAddresses) != 2 || !leaf.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)) || len(leaf.IPAddresses[0]) != net.IPv4len {
+		t.Errorf("IPAddresses %v", leaf.IPAddresses)
+	}
+	if len(leaf.DNSNames) != 1 || len(leaf.EmailAddresses) != 1 || len(leaf.URIs) != 1 || leaf.URIs[0].String() != uri.String() {
+		t.Errorf("SANs %v %v %v", leaf.DNSNames, leaf.EmailAddresses, leaf.URIs)
+	}
+	if len(leaf.OCSPServer) != 1 || len(leaf.IssuingCertificateURL) != 1 || len(leaf.CRLDistributionPoints) != 1 || len(leaf.PolicyIdentifiers) != 1 {
+		t.Errorf("OCSP %v, issuers %v, CRL %v, policies %v", leaf.OCSPServer, leaf.IssuingCertificateURL, leaf.CRLDistributionPoints, leaf.PolicyIdentifiers)
+	}
+	found := false
+	for _, e := range leaf.Extensions {
+		if e.Id.Equal(asn1.ObjectIdentifier{1, 2, 3, 6}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("extra extension missing")
+	}
+}
+
+func TestCreateCertificateMixed(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm2Key, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ECDSA Root"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(24 * time.Hour),
+		KeyUsage:              KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	// Only SM2 subject keys can be certified.
+	if _, err := CreateCertificate(caTemplate, caTemplate, &ecKey.PublicKey, ecKey); err == nil {
+		t.Fatal("an ECDSA public key was accepted as subject key")
+	}
+
+	// An SM2 certificate issued by an ECDSA CA.
+	sm2Template := &Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "SM2 leaf"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(24 * time.Hour),
+	}
+	ecIssuer := &Certificate{
+		Subject:               caTemplate.Subject,
+		PublicKey:             &ecKey.PublicKey,
+		PublicKeyAlgorithm:    ECDSA,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := CreateCertificate(sm2Template, ecIssuer, sm2Key.Public(), ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SignatureAlgorithm != ECDSAWithSHA256 || cert.PublicKeyAlgorithm != SM2 {
+		t.Errorf("algorithms %v, %v", cert.SignatureAlgorithm, cert.PublicKeyAlgorithm)
+	}
+	if err := cert.CheckSignatureFrom(ecIssuer); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateCertificateErrors(t *testing.T) {
+	key, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &Certificate{SerialNumber: big.NewInt(1)}
+
+	if _, err := CreateCertificate(&Certificate{}, template, key.Public(), key); err == nil {
+		t.Error("missing serial number accepted")
+	}
+	bad := *template
+	bad.SignatureAlgorithm = SHA256WithRSA
+	if _, err := CreateCertificate(&bad, template, key.Public(), key); err == nil {
+		t.Error("mismatched signature algorithm accepted")
+	}
+	if _, err := CreateCertificate(template, template, key.Public(), "not a key"); err == nil {
+		t.Error("non-signer private key accepted")
+	}
+	bad = *template
+	bad.DNSNames = []string{"例子.example.com"}
+	if _, err := CreateCertificate(&bad, template, key.Public(), key); err == nil {
+		t.Error("non-IA5 DNS name accepted")
+	}
+}
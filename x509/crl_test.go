@@ -0,0 +1,227 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package x509
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// A CRL of the root of opensslRootPEM revoking opensslLeafPEM, created by
+// "openssl ca -gencrl" using "-sigopt distid:1234567812345678".
+const opensslCRLPEM = `-----BEGIN X509 CRL-----
+MIIBKDCBzgIBATAKBggqgRzPVQGDdTBHMQswCQYDVQQGEwJDTjEVMBMGA1UECgwM
+Um9uZ3plciBUZXN0MSEwHwYDVQQDDBhSb25nemVyIFRlc3QgU00yIFJvb3QgQ0EX
+DTI2MTAxODExNTU0OVoYDzIxMjYwOTI0MTE1NTQ5WjAjMCECAhI0Fw0yNjEwMTgx
+MTU1NDlaMAwwCgYDVR0VBAMKAQGgLzAtMB8GA1UdIwQYMBaAFKI62enBzFU1vajp
+jKpdi7BjqUu6MAoGA1UdFAQDAgEBMAoGCCqBHM9VAYN1A0kAMEYCIQCtfoUENkDe
+lT/i9FJ197ImHsTyQ25zf1eD8H1JfWwQfAIhAIIfIlCNA1wx1fLY16CPf5WBEvVY
+GQCma7PDWFG8OM6V
+-----END X509 CRL-----
+`
+
+func TestParseRevocationList(t *testing.T) {
+	block, _ := pem.Decode([]byte(opensslCRLPEM))
+	crl, err := ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+
+	if err := crl.CheckSignatureFrom(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(leaf); err == nil {
+		t.Error("CRL verified with a non-CA certificate")
+	}
+	if crl.SignatureAlgorithm != SM2WithSM3 || !bytes.Equal(crl.RawIssuer, root.RawSubject) || crl.Issuer.CommonName != root.Subject.CommonName {
+		t.Errorf("algorithm %v, issuer %v", crl.SignatureAlgorithm, crl.Issuer)
+	}
+	if !bytes.Equal(crl.AuthorityKeyId, root.SubjectKeyId) || crl.Number == nil || crl.Number.Int64() != 1 {
+		t.Errorf("AuthorityKeyId %x, Number %v", crl.AuthorityKeyId, crl.Number)
+	}
+	if !crl.NextUpdate.After(crl.ThisUpdate) {
+		t.Errorf("ThisUpdate %v, NextUpdate %v", crl.ThisUpdate, crl.NextUpdate)
+	}
+	if len(crl.RevokedCertificates) != 1 || crl.RevokedCertificates[0].SerialNumber.Cmp(leaf.SerialNumber) != 0 ||
+		len(crl.RevokedCertificates[0].Extensions) != 1 {
+		t.Fatalf("revoked certificates %v", crl.RevokedCertificates)
+	}
+
+	crl.Signature = append([]byte{}, crl.Signature...)
+	crl.Signature[8] ^= 1
+	if err := crl.CheckSignatureFrom(root); err == nil {
+		t.Error("tampered CRL verified")
+	}
+
+	if _, err := ParseRevocationList(append(append([]byte{}, block.Bytes...), 0)); err == nil {
+		t.Error("trailing data accepted")
+	}
+}
+
+func TestCreateRevocationList(t *testing.T) {
+	key := generateSM2Key(t)
+	issuer := issue(t, caTemplate("CRL Issuer"), nil, key.Public(), key)
+
+	reason, _ := asn1.Marshal(asn1.Enumerated(1))
+	template := &RevocationList{
+		Number:     big.NewInt(7),
+		ThisUpdate: verifyTime,
+		NextUpdate: verifyTime.Add(24 * time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{
+			{
+				SerialNumber:   big.NewInt(0x1234),
+				RevocationTime: verifyTime.Add(-time.Hour).In(time.FixedZone("CST", 8*3600)),
+				Extensions:     []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 21}, Value: reason}},
+			},
+			{SerialNumber: big.NewInt(42), RevocationTime: verifyTime.Add(-2 * time.Hour)},
+		},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{5, 0}}},
+	}
+	der, err := CreateRevocationList(template, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		t.Fatal(err)
+	}
+	if crl.SignatureAlgorithm != SM2WithSM3 || crl.Number.Cmp(template.Number) != 0 ||
+		!bytes.Equal(crl.RawIssuer, issuer.RawSubject) || !bytes.Equal(crl.AuthorityKeyId, issuer.SubjectKeyId) {
+		t.Errorf("algorithm %v, number %v, issuer %v, AuthorityKeyId %x", crl.SignatureAlgorithm, crl.Number, crl.Issuer, crl.AuthorityKeyId)
+	}
+	if !crl.ThisUpdate.Equal(template.ThisUpdate) || !crl.NextUpdate.Equal(template.NextUpdate) {
+		t.Errorf("ThisUpdate %v, NextUpdate %v", crl.ThisUpdate, crl.NextUpdate)
+	}
+	if len(crl.RevokedCertificates) != 2 || !crl.RevokedCertificates[0].RevocationTime.Equal(template.RevokedCertificates[0].RevocationTime) ||
+		len(crl.RevokedCertificates[0].Extensions) != 1 {
+		t.Errorf("revoked certificates %v", crl.RevokedCertificates)
+	}
+	if len(crl.Extensions) != 3 || !crl.Extensions[2].Id.Equal(asn1.ObjectIdentifier{1, 2, 3, 4}) {
+		t.Errorf("extensions %v", crl.Extensions)
+	}
+
+	// An empty CRL has no revokedCertificates.
+	der, err = CreateRevocationList(&RevocationList{Number: big.NewInt(8), ThisUpdate: verifyTime, NextUpdate: verifyTime.Add(time.Hour)}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crl, err = ParseRevocationList(der); err != nil || len(crl.RevokedCertificates) != 0 {
+		t.Errorf("empty CRL: %v, %v", err, crl.RevokedCertificates)
+	}
+
+	for name, test := range map[string]struct {
+		template *RevocationList
+		issuer   *Certificate
+	}{
+		"nil template":     {nil, issuer},
+		"nil issuer":       {template, nil},
+		"no number":        {&RevocationList{ThisUpdate: verifyTime, NextUpdate: verifyTime}, issuer},
+		"next before this": {&RevocationList{Number: big.NewInt(1), ThisUpdate: verifyTime, NextUpdate: verifyTime.Add(-time.Hour)}, issuer},
+		"no crlSign": {template, func() *Certificate {
+			c := *issuer
+			c.KeyUsage = KeyUsageCertSign
+			return &c
+		}()},
+		"no SubjectKeyId": {template, func() *Certificate {
+			c := *issuer
+			c.SubjectKeyId = nil
+			return &c
+		}()},
+	} {
+		if _, err := CreateRevocationList(test.template, test.issuer, key); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestCheckRevocation(t *testing.T) {
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+	block, _ := pem.Decode([]byte(opensslCRLPEM))
+	crl, err := ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := NewCertPool()
+	roots.AddCert(root)
+	chains, err := leaf.Verify(VerifyOptions{Roots: roots, CurrentTime: leaf.NotBefore.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckRevocation(chains[0], nil); err != nil {
+		t.Errorf("no CRLs: %v", err)
+	}
+	err = CheckRevocation(chains[0], []*RevocationList{crl})
+	if e, ok := err.(RevokedError); !ok || !e.Cert.Equal(leaf) || !e.RevocationTime.Equal(crl.RevokedCertificates[0].RevocationTime) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// A CRL with the right issuer name but signed by another key is an error.
+	key := generateSM2Key(t)
+	impostor := issue(t, &Certificate{
+		RawSubject:            root.RawSubject,
+		KeyUsage:              KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, key.Public(), key)
+	der, err := CreateRevocationList(&RevocationList{
+		Number:              big.NewInt(2),
+		ThisUpdate:          verifyTime,
+		NextUpdate:          verifyTime.Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{{SerialNumber: leaf.SerialNumber, RevocationTime: verifyTime}},
+	}, impostor, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, crls := range [][]*RevocationList{{forged}, {forged, crl}} {
+		err := CheckRevocation(chains[0], crls)
+		if _, ok := err.(RevokedError); ok || err == nil {
+			t.Errorf("forged CRL: unexpected error %v", err)
+		}
+	}
+
+	// A CRL of the issuer that does not list the certificate.
+	issuerKey := generateSM2Key(t)
+	issuer := issue(t, caTemplate("Issuer"), nil, issuerKey.Public(), issuerKey)
+	cert := issue(t, leafTemplate(), issuer, key.Public(), issuerKey)
+	der, err = CreateRevocationList(&RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          verifyTime,
+		NextUpdate:          verifyTime.Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{{SerialNumber: new(big.Int).Add(cert.SerialNumber, big.NewInt(1)), RevocationTime: verifyTime}},
+	}, issuer, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckRevocation([]*Certificate{cert, issuer}, []*RevocationList{other, crl}); err != nil {
+		t.Errorf("unrevoked certificate: %v", err)
+	}
+}
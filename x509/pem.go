@@ -0,0 +1,82 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package x509
+
+import (
+	"crypto"
+	"encoding/pem"
+	"errors"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+// PrivateKeyToPEM encodes an SM2 private key as a PKCS #8 PEM block of type
+// "PRIVATE KEY".
+func PrivateKeyToPEM(key *sm2.PrivateKey) ([]byte, error) {
+	der, err := MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// PEMToPrivateKey decodes the first private key in data, either a PKCS #8
+// block of type "PRIVATE KEY" or a SEC 1 block of type "EC PRIVATE KEY" or
+// "SM2 PRIVATE KEY". Curve parameter blocks written by "openssl ecparam
+// -genkey" before the key are skipped.
+func PEMToPrivateKey(data []byte) (*sm2.PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("x509: no private key found in PEM data")
+		}
+		if _, ok := block.Headers["Proc-Type"]; ok {
+			return nil, errors.New("x509: legacy encrypted PEM blocks are not supported")
+		}
+
+		switch block.Type {
+		case "EC PARAMETERS", "SM2 PARAMETERS":
+			continue
+		case "PRIVATE KEY":
+			return ParsePKCS8PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY", "SM2 PRIVATE KEY":
+			return ParseECPrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("x509: the private key is encrypted, use EncryptedPEMToPrivateKey")
+		default:
+			return nil, errors.New("x509: unexpected PEM block type " + block.Type)
+		}
+	}
+}
+
+// PublicKeyToPEM encodes an SM2 public key, as accepted by
+// MarshalPKIXPublicKey, as a PEM block of type "PUBLIC KEY".
+func PublicKeyToPEM(pub crypto.PublicKey) ([]byte, error) {
+	der, err := MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// PEMToPublicKey decodes the first PEM block of data, which must be of type
+// "PUBLIC KEY".
+func PEMToPublicKey(data []byte) (*sm2.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("x509: no public key found in PEM data")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, errors.New("x509: unexpected PEM block type " + block.Type)
+	}
+	return ParsePKIXPublicKey(block.Bytes)
+}
@@ -0,0 +1,108 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE-GO file.
+package x509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+// pkcs8 reflects an ASN.1, PKCS #8 PrivateKey. See
+// ftp://ftp.rsasecurity.com/pub/pkcs/pkcs-8/pkcs-8v1_2.asn
+// and RFC 5208.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	// optional attributes omitted.
+}
+
+// ParsePKCS8PrivateKey parses an SM2 private key in PKCS #8, ASN.1 DER form.
+//
+// The algorithm may be id-ecPublicKey with the sm2p256v1 curve as parameter,
+// as written by OpenSSL 1.1.1 and later and by MarshalPKCS8PrivateKey, or
+// the SM2 OID itself, as written by some versions of GmSSL.
+//
+// This kind of key is commonly encoded in PEM blocks of type "PRIVATE KEY".
+func ParsePKCS8PrivateKey(der []byte) (*sm2.PrivateKey, error) {
+	var privKey pkcs8
+	rest, err := asn1.Unmarshal(der, &privKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after PKCS#8 private key")
+	}
+
+	algo := privKey.Algo.Algorithm
+	if !algo.Equal(oidPublicKeyECDSA) && !algo.Equal(oidSM2) {
+		return nil, fmt.Errorf("x509: PKCS#8 wrapping contained private key with unknown algorithm: %v", algo)
+	}
+
+	// The curve is optional with the SM2 OID, the ECPrivateKey may name it
+	// instead.
+	var namedCurveOID asn1.ObjectIdentifier
+	bytes := privKey.Algo.Parameters.FullBytes
+	if len(bytes) != 0 && !(len(bytes) == 2 && bytes[0] == asn1.TagNull) {
+		if rest, err := asn1.Unmarshal(bytes, &namedCurveOID); err != nil || len(rest) != 0 {
+			return nil, errors.New("x509: invalid SM2 parameters in PKCS#8 private key")
+		}
+	} else if algo.Equal(oidPublicKeyECDSA) {
+		return nil, errors.New("x509: missing curve in PKCS#8 EC private key")
+	}
+
+	key, err := parseECPrivateKey(namedCurveOID, privKey.PrivateKey)
+	if err != nil {
+		return nil, errors.New("x509: failed to parse EC private key embedded in PKCS#8: " + err.Error())
+	}
+	return key, nil
+}
+
+// MarshalPKCS8PrivateKey converts an SM2 private key to PKCS #8, ASN.1 DER
+// form, with id-ecPublicKey as the algorithm and sm2p256v1 as the curve,
+// the form read by OpenSSL.
+//
+// This kind of key is commonly encoded in PEM blocks of type "PRIVATE KEY".
+func MarshalPKCS8PrivateKey(key *sm2.PrivateKey) ([]byte, error) {
+	if key == nil || key.PrivateKey == nil {
+		return nil, errors.New("x509: private key should not be nil")
+	}
+
+	oidBytes, err := asn1.Marshal(oidSM2)
+	if err != nil {
+		return nil, errors.New("x509: failed to marshal curve OID: " + err.Error())
+	}
+
+	// The curve is already in the algorithm parameters, so it is omitted
+	// from the ECPrivateKey.
+	ecKey, err := marshalECPrivateKeyWithOID(key, nil)
+	if err != nil {
+		return nil, errors.New("x509: failed to marshal EC private key while building PKCS#8: " + err.Error())
+	}
+
+	return asn1.Marshal(pkcs8{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm: oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{
+				FullBytes: oidBytes,
+			},
+		},
+		PrivateKey: ecKey,
+	})
+}
@@ -0,0 +1,298 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE-GO file.
+package x509
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rongzer/gm/sm2"
+	"github.com/rongzer/gm/sm3"
+	"github.com/rongzer/gm/sm4"
+)
+
+var (
+	oidPBES2   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSM3 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401, 2}
+	oidSM4CBC  = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 104, 2}
+)
+
+// IncorrectPasswordError is returned when an incorrect password is detected.
+var IncorrectPasswordError = errors.New("x509: decryption password incorrect")
+
+const (
+	// DefaultIterations is the PBKDF2 iteration count used when
+	// PBES2Opts.Iterations is zero.
+	DefaultIterations = 10000
+	// DefaultSaltSize is the PBKDF2 salt size in bytes used when
+	// PBES2Opts.SaltSize is zero.
+	DefaultSaltSize = 16
+)
+
+// PBES2Opts holds the PBKDF2 parameters of an encrypted private key. A nil
+// *PBES2Opts uses the defaults.
+type PBES2Opts struct {
+	Iterations int
+	SaltSize   int
+}
+
+// encryptedPrivateKeyInfo reflects the PKCS #8 EncryptedPrivateKeyInfo of
+// RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+// pbes2Params reflects PBES2-params of RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params reflects PBKDF2-params of RFC 8018. The salt must be
+// specified, not an AlgorithmIdentifier.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// EncryptPKCS8PrivateKey converts an SM2 private key to PKCS #8 and encrypts
+// it with password, using PBES2 with PBKDF2-HMAC-SM3 and SM4-CBC as in
+// GM/T 0006. The result is an EncryptedPrivateKeyInfo in ASN.1 DER form,
+// commonly encoded in PEM blocks of type "ENCRYPTED PRIVATE KEY". If random
+// is nil, crypto/rand.Reader is used for the salt and IV.
+func EncryptPKCS8PrivateKey(random io.Reader, key *sm2.PrivateKey, password []byte, opts *PBES2Opts) ([]byte, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	iterations, saltSize := DefaultIterations, DefaultSaltSize
+	if opts != nil {
+		if opts.Iterations != 0 {
+			iterations = opts.Iterations
+		}
+		if opts.SaltSize != 0 {
+			saltSize = opts.SaltSize
+		}
+	}
+	if iterations < 1 || saltSize < 8 {
+		return nil, errors.New("x509: invalid PBES2 parameters")
+	}
+
+	plain, err := MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltSize)
+	iv := make([]byte, sm4.BlockSize)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, errors.New("x509: failed to generate salt: " + err.Error())
+	}
+	if _, err := io.ReadFull(random, iv); err != nil {
+		return nil, errors.New("x509: failed to generate IV: " + err.Error())
+	}
+
+	block, err := sm4.NewCipher(pbkdf2SM3(password, salt, iterations, sm4.BlockSize))
+	if err != nil {
+		return nil, err
+	}
+	padding := sm4.BlockSize - len(plain)%sm4.BlockSize
+	encrypted := append(plain, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: iterations,
+		PRF: pkix.AlgorithmIdentifier{
+			Algorithm:  oidHMACSM3,
+			Parameters: asn1.NullRawValue,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivBytes, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams},
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidSM4CBC,
+			Parameters: asn1.RawValue{FullBytes: ivBytes},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedData: encrypted,
+	})
+}
+
+// DecryptPKCS8PrivateKey decrypts an EncryptedPrivateKeyInfo in ASN.1 DER
+// form protected with PBES2, PBKDF2-HMAC-SM3 and SM4-CBC, and parses the
+// SM2 private key it holds. It returns IncorrectPasswordError if the
+// password does not decrypt the key.
+func DecryptPKCS8PrivateKey(der, password []byte) (*sm2.PrivateKey, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after encrypted private key")
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("x509: unsupported private key encryption %v", info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("x509: invalid PBES2 parameters")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("x509: unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	if !params.EncryptionScheme.Algorithm.Equal(oidSM4CBC) {
+		return nil, fmt.Errorf("x509: unsupported encryption scheme %v", params.EncryptionScheme.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, errors.New("x509: invalid PBKDF2 parameters")
+	}
+	if !kdf.PRF.Algorithm.Equal(oidHMACSM3) {
+		return nil, fmt.Errorf("x509: unsupported PBKDF2 PRF %v", kdf.PRF.Algorithm)
+	}
+	if kdf.IterationCount < 1 || (kdf.KeyLength != 0 && kdf.KeyLength != sm4.BlockSize) {
+		return nil, errors.New("x509: invalid PBKDF2 parameters")
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != sm4.BlockSize {
+		return nil, errors.New("x509: invalid SM4-CBC IV")
+	}
+	encrypted := info.EncryptedData
+	if len(encrypted) == 0 || len(encrypted)%sm4.BlockSize != 0 {
+		return nil, errors.New("x509: encrypted private key is not a multiple of the block size")
+	}
+
+	block, err := sm4.NewCipher(pbkdf2SM3(password, kdf.Salt, kdf.IterationCount, sm4.BlockSize))
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, encrypted)
+
+	// A wrong password shows up as invalid padding most of the time, and
+	// otherwise as a PKCS #8 structure that does not parse.
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > sm4.BlockSize {
+		return nil, IncorrectPasswordError
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if subtle.ConstantTimeByteEq(b, byte(padding)) != 1 {
+			return nil, IncorrectPasswordError
+		}
+	}
+	key, err := ParsePKCS8PrivateKey(plain[:len(plain)-padding])
+	if err != nil {
+		return nil, IncorrectPasswordError
+	}
+	return key, nil
+}
+
+// EncryptedPrivateKeyToPEM encrypts an SM2 private key as
+// EncryptPKCS8PrivateKey does and encodes it as a PEM block of type
+// "ENCRYPTED PRIVATE KEY".
+func EncryptedPrivateKeyToPEM(key *sm2.PrivateKey, password []byte, opts *PBES2Opts) ([]byte, error) {
+	der, err := EncryptPKCS8PrivateKey(rand.Reader, key, password, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// EncryptedPEMToPrivateKey decodes the first PEM block of data, which must
+// be of type "ENCRYPTED PRIVATE KEY", and decrypts it with password as
+// DecryptPKCS8PrivateKey does.
+func EncryptedPEMToPrivateKey(data, password []byte) (*sm2.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("x509: no private key found in PEM data")
+	}
+	if block.Type != "ENCRYPTED PRIVATE KEY" {
+		return nil, errors.New("x509: unexpected PEM block type " + block.Type)
+	}
+	return DecryptPKCS8PrivateKey(block.Bytes, password)
+}
+
+// pbkdf2SM3 derives a key of keyLen bytes with PBKDF2 of RFC 8018, using
+// HMAC-SM3 as the pseudorandom function.
+func pbkdf2SM3(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sm3.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	U := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		// N.B.: || means concatenation, ^ means XOR
+		// for each block T_i = U_1 ^ U_2 ^ ... ^ U_iter
+		// U_1 = PRF(password, salt || uint(i))
+		prf.Reset()
+		prf.Write(salt)
+		buf[0] = byte(block >> 24)
+		buf[1] = byte(block >> 16)
+		buf[2] = byte(block >> 8)
+		buf[3] = byte(block)
+		prf.Write(buf[:4])
+		dk = prf.Sum(dk)
+		T := dk[len(dk)-hashLen:]
+		copy(U, T)
+
+		// U_n = PRF(password, U_(n-1))
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(U)
+			U = U[:0]
+			U = prf.Sum(U)
+			for x := range U {
+				T[x] ^= U[x]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
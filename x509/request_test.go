@@ -0,0 +1,212 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package x509
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+// A CSR for the key of opensslLeafPEM with requested extensions, created by
+// OpenSSL 3 using "-sigopt distid:1234567812345678".
+const opensslCSRPEM = `-----BEGIN CERTIFICATE REQUEST-----
+MIIBhzCCASwCAQAwRTELMAkGA1UEBhMCQ04xFTATBgNVBAoMDFJvbmd6ZXIgVGVz
+dDEfMB0GA1UEAwwWZGV2aWNlLTAwMS5leGFtcGxlLmNvbTBZMBMGByqGSM49AgEG
+CCqBHM9VAYItA0IABOZ2BRmtbnjAv7hvyP6zgsBssswPul7tQbXnBARBFJud1zkI
+z45t59kbTmeZBpWhMGp52UjstH+OJH/Lj+BF/XaggYQwgYEGCSqGSIb3DQEJDjF0
+MHIwSwYDVR0RBEQwQoIWZGV2aWNlLTAwMS5leGFtcGxlLmNvbYcECgAAAYESZGV2
+aWNlQGV4YW1wbGUuY29thg51cm46ZGV2aWNlOjAwMTAOBgNVHQ8BAf8EBAMCB4Aw
+EwYDVR0lBAwwCgYIKwYBBQUHAwIwCgYIKoEcz1UBg3UDSQAwRgIhAIriK9GPNNie
+mGpuS+fnlDUrgi2DLJvJKoZ2IWblRn1NAiEA7HsS3hbc9RYk9RbE4ID4ZVkAafMC
+KCB7TVcBYI0bWL4=
+-----END CERTIFICATE REQUEST-----
+`
+
+func TestParseCertificateRequest(t *testing.T) {
+	block, _ := pem.Decode([]byte(opensslCSRPEM))
+	csr, err := ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	if csr.SignatureAlgorithm != SM2WithSM3 || csr.PublicKeyAlgorithm != SM2 || csr.Version != 0 {
+		t.Errorf("algorithms %v, %v, version %d", csr.SignatureAlgorithm, csr.PublicKeyAlgorithm, csr.Version)
+	}
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+	if !leaf.PublicKey.(*sm2.PublicKey).Equal(csr.PublicKey) {
+		t.Error("CSR public key does not match the leaf certificate")
+	}
+	if csr.Subject.CommonName != "device-001.example.com" || len(csr.Subject.Organization) != 1 || csr.Subject.Organization[0] != "Rongzer Test" {
+		t.Errorf("subject %v", csr.Subject)
+	}
+	if len(csr.Extensions) != 3 {
+		t.Fatalf("got %d extensions, want 3", len(csr.Extensions))
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "device-001.example.com" ||
+		len(csr.IPAddresses) != 1 || !csr.IPAddresses[0].Equal(net.IPv4(10, 0, 0, 1)) ||
+		len(csr.EmailAddresses) != 1 || csr.EmailAddresses[0] != "device@example.com" ||
+		len(csr.URIs) != 1 || csr.URIs[0].String() != "urn:device:001" {
+		t.Errorf("SANs %v %v %v %v", csr.DNSNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs)
+	}
+	if ku, err := parseKeyUsageExtension(csr.Extensions[1].Value); err != nil || ku != KeyUsageDigitalSignature || !csr.Extensions[1].Critical {
+		t.Errorf("key usage %x, %v", ku, err)
+	}
+
+	csr.Signature = append([]byte{}, csr.Signature...)
+	csr.Signature[10] ^= 1
+	if err := csr.CheckSignature(); err == nil {
+		t.Error("tampered CSR verified")
+	}
+
+	if _, err := ParseCertificateRequest(append(append([]byte{}, block.Bytes...), 0)); err == nil {
+		t.Error("trailing data accepted")
+	}
+}
+
+func TestCreateCertificateRequest(t *testing.T) {
+	key, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri, _ := url.Parse("urn:device:002")
+	basicConstraints, _ := asn1.Marshal(basicConstraints{false, -1})
+	template := &CertificateRequest{
+		Subject:        pkix.Name{CommonName: "device-002.example.com", Country: []string{"CN"}},
+		DNSNames:       []string{"device-002.example.com"},
+		EmailAddresses: []string{"device@example.com"},
+		IPAddresses:    []net.IP{net.IPv4(10, 0, 0, 2)},
+		URIs:           []*url.URL{uri},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionBasicConstraints, Critical: true, Value: basicConstraints},
+		},
+	}
+	der, err := CreateCertificateRequest(template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	if !key.Public().(*sm2.PublicKey).Equal(csr.PublicKey) {
+		t.Error("public key mismatch")
+	}
+	if csr.Subject.CommonName != template.Subject.CommonName || len(csr.Subject.Country) != 1 {
+		t.Errorf("subject %v", csr.Subject)
+	}
+	if len(csr.DNSNames) != 1 || len(csr.EmailAddresses) != 1 || len(csr.IPAddresses) != 1 || len(csr.URIs) != 1 {
+		t.Errorf("SANs %v %v %v %v", csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs)
+	}
+	if len(csr.Extensions) != 2 || !csr.Extensions[1].Id.Equal(oidExtensionBasicConstraints) || !csr.Extensions[1].Critical {
+		t.Errorf("extensions %v", csr.Extensions)
+	}
+
+	// Without extensions the attributes are empty.
+	der, err = CreateCertificateRequest(&CertificateRequest{Subject: pkix.Name{CommonName: "bare"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr, err = ParseCertificateRequest(der); err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil || len(csr.Extensions) != 0 {
+		t.Errorf("bare CSR: %v, %d extensions", err, len(csr.Extensions))
+	}
+
+	if _, err := CreateCertificateRequest(template, "not a key"); err == nil {
+		t.Error("non-signer private key accepted")
+	}
+}
+
+// TestIssueFromCertificateRequest follows a CSR from the device to the CA.
+func TestIssueFromCertificateRequest(t *testing.T) {
+	caKey, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceKey, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Device CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := CreateCertificate(caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csrDER, err := CreateCertificateRequest(&CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device-003"},
+		DNSNames: []string{"device-003.example.com"},
+	}, deviceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+
+	certDER, err := CreateCertificate(&Certificate{
+		SerialNumber:    big.NewInt(3),
+		RawSubject:      csr.RawSubject,
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.Add(time.Hour),
+		ExtraExtensions: csr.Extensions,
+	}, ca, csr.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.RawSubject, csr.RawSubject) || len(cert.DNSNames) != 1 || cert.DNSNames[0] != "device-003.example.com" {
+		t.Errorf("subject %v, DNS names %v", cert.Subject, cert.DNSNames)
+	}
+	if !deviceKey.Public().(*sm2.PublicKey).Equal(cert.PublicKey) {
+		t.Error("certified key mismatch")
+	}
+}
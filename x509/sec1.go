@@ -0,0 +1,116 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE-GO file.
+package x509
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+const ecPrivKeyVersion = 1
+
+// ecPrivateKey reflects an ASN.1 Elliptic Curve Private Key Structure.
+// References:
+//
+//	RFC 5915
+//	SEC1 - http://www.secg.org/sec1-v2.pdf
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// ParseECPrivateKey parses an SM2 private key in SEC 1, ASN.1 DER form.
+//
+// This kind of key is commonly encoded in PEM blocks of type "EC PRIVATE
+// KEY", or "SM2 PRIVATE KEY" when written by OpenSSL 3.
+func ParseECPrivateKey(der []byte) (*sm2.PrivateKey, error) {
+	return parseECPrivateKey(nil, der)
+}
+
+// MarshalECPrivateKey converts an SM2 private key to SEC 1, ASN.1 DER form,
+// naming the sm2p256v1 curve.
+//
+// This kind of key is commonly encoded in PEM blocks of type "EC PRIVATE
+// KEY".
+func MarshalECPrivateKey(key *sm2.PrivateKey) ([]byte, error) {
+	if key == nil || key.PrivateKey == nil {
+		return nil, errors.New("x509: private key should not be nil")
+	}
+	return marshalECPrivateKeyWithOID(key, oidSM2)
+}
+
+// marshalECPrivateKeyWithOID marshals an SM2 private key into ASN.1, DER
+// format and sets the curve ID to the given OID, or omits it if OID is nil.
+func marshalECPrivateKeyWithOID(key *sm2.PrivateKey, oid asn1.ObjectIdentifier) ([]byte, error) {
+	if key.D == nil || key.D.Sign() <= 0 || key.D.BitLen() > 256 {
+		return nil, errors.New("invalid private key")
+	}
+	privateKey := make([]byte, 32)
+	b := key.D.Bytes()
+	copy(privateKey[32-len(b):], b)
+	return asn1.Marshal(ecPrivateKey{
+		Version:       ecPrivKeyVersion,
+		PrivateKey:    privateKey,
+		NamedCurveOID: oid,
+		PublicKey:     asn1.BitString{Bytes: sm2.Marshal(key.X, key.Y)},
+	})
+}
+
+// parseECPrivateKey parses an ASN.1 Elliptic Curve Private Key Structure.
+// The OID for the named curve may be provided from another source (such as
+// the PKCS8 container) - if it is provided then use this instead of the OID
+// that may exist in the EC private key structure.
+func parseECPrivateKey(namedCurveOID asn1.ObjectIdentifier, der []byte) (*sm2.PrivateKey, error) {
+	var privKey ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &privKey); err != nil {
+		return nil, errors.New("x509: failed to parse EC private key: " + err.Error())
+	}
+	if privKey.Version != ecPrivKeyVersion {
+		return nil, fmt.Errorf("x509: unknown EC private key version %d", privKey.Version)
+	}
+
+	if namedCurveOID == nil {
+		namedCurveOID = privKey.NamedCurveOID
+	}
+	if !namedCurveOID.Equal(oidSM2) {
+		return nil, errors.New("x509: unknown elliptic curve")
+	}
+
+	// Some encoders strip the leading zeros of the private key, others pad
+	// it beyond the size of the order.
+	k := new(big.Int).SetBytes(privKey.PrivateKey)
+	if k.BitLen() > 256 {
+		return nil, errors.New("x509: invalid elliptic curve private key value")
+	}
+	key, err := sm2.NewPrivateKey(k.Bytes())
+	if err != nil {
+		return nil, errors.New("x509: invalid elliptic curve private key value")
+	}
+
+	// The optional public key must match the private key.
+	if len(privKey.PublicKey.Bytes) != 0 {
+		pub, err := sm2.ParsePublicKey(privKey.PublicKey.Bytes)
+		if err != nil || !pub.Equal(&key.PublicKey) {
+			return nil, errors.New("x509: EC private key does not match its public key")
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,69 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package x509
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+// opensslSEC1PEM is the key of opensslPKCS8PEM as written by "openssl ec"
+// with OpenSSL 3.0.
+const opensslSEC1PEM = `-----BEGIN SM2 PRIVATE KEY-----
+MHcCAQEEINs4KfZTCufbMYjnuIuUVbFMzU+TgxEkWw42zY6FfsXEoAoGCCqBHM9V
+AYItoUQDQgAEtuoY/a//grom+gMm0mwT9OliR5yZeP7p2d0JT8FitCIvj2F5abIe
+YM5+DIQV6zCi3ouDjDQsORi4KF5tUpG6uw==
+-----END SM2 PRIVATE KEY-----
+`
+
+func TestParseECPrivateKey(t *testing.T) {
+	block, _ := pem.Decode([]byte(opensslSEC1PEM))
+	key, err := ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if got := hex.EncodeToString(key.D.Bytes()); got != opensslKeyD {
+		t.Errorf("D = %s, want %s", got, opensslKeyD)
+	}
+
+	der, err := MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if !bytes.Equal(der, block.Bytes) {
+		t.Errorf("marshaled key is\n%x\nwant\n%x", der, block.Bytes)
+	}
+}
+
+func TestECPrivateKeyRoundTrip(t *testing.T) {
+	key, _ := sm2.GenerateKey()
+	der, err := MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseECPrivateKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.D.Cmp(key.D) != 0 {
+		t.Error("round trip changed the key")
+	}
+
+	// The curve is required when there is no PKCS #8 wrapping.
+	inner, _ := marshalECPrivateKeyWithOID(key, nil)
+	if _, err := ParseECPrivateKey(inner); err == nil {
+		t.Error("parsed a key without a curve")
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package x509
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+var verifyTime = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// issue creates a certificate for pub from template, signed by priv on
+// behalf of parent, or self-signed if parent is nil.
+func issue(t *testing.T, template, parent *Certificate, pub crypto.PublicKey, priv crypto.Signer) *Certificate {
+	t.Helper()
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = verifyTime.Add(-24 * time.Hour)
+		template.NotAfter = verifyTime.Add(24 * time.Hour)
+	}
+	if parent == nil {
+		parent = template
+	}
+	der, err := CreateCertificate(template, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func caTemplate(name string) *Certificate {
+	return &Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+func leafTemplate(dnsNames ...string) *Certificate {
+	return &Certificate{
+		Subject:     pkix.Name{CommonName: "leaf"},
+		KeyUsage:    KeyUsageDigitalSignature,
+		ExtKeyUsage: []ExtKeyUsage{ExtKeyUsageServerAuth},
+		DNSNames:    dnsNames,
+	}
+}
+
+func generateSM2Key(t *testing.T) *sm2.PrivateKey {
+	t.Helper()
+	key, err := sm2.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyOpenSSLChain(t *testing.T) {
+	root := mustParseCertificate(t, opensslRootPEM)
+	leaf := mustParseCertificate(t, opensslLeafPEM)
+
+	roots := NewCertPool()
+	roots.AddCert(root)
+	opts := VerifyOptions{
+		DNSName:     "gm.example.com",
+		Roots:       roots,
+		CurrentTime: leaf.NotBefore.Add(time.Hour),
+	}
+
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 2 || !chains[0][0].Equal(leaf) || !chains[0][1].Equal(root) {
+		t.Fatalf("unexpected chains %v", chains)
+	}
+
+	for _, host := range []string{"www.gm.example.com", "GM.Example.com", "127.0.0.1", "[127.0.0.1]"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("VerifyHostname(%q): %v", host, err)
+		}
+	}
+	for _, host := range []string{"example.com", "a.b.gm.example.com", "127.0.0.2"} {
+		if err := leaf.VerifyHostname(host); err == nil {
+			t.Errorf("VerifyHostname(%q) succeeded", host)
+		} else if _, ok := err.(HostnameError); !ok {
+			t.Errorf("VerifyHostname(%q): unexpected error %v", host, err)
+		}
+	}
+
+	opts.DNSName = "other.example.com"
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Error("verified a certificate for the wrong host")
+	}
+
+	opts.DNSName = ""
+	opts.CurrentTime = leaf.NotBefore.Add(-time.Hour)
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Error("verified a certificate that is not yet valid")
+	} else if e, ok := err.(CertificateInvalidError); !ok || e.Reason != Expired {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	opts.CurrentTime = leaf.NotBefore.Add(time.Hour)
+	opts.KeyUsages = []ExtKeyUsage{ExtKeyUsageCodeSigning}
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Error("verified a certificate for the wrong key usage")
+	} else if e, ok := err.(CertificateInvalidError); !ok || e.Reason != IncompatibleUsage {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	opts.KeyUsages = []ExtKeyUsage{ExtKeyUsageAny}
+	if _, err := leaf.Verify(opts); err != nil {
+		t.Error(err)
+	}
+
+	opts.Roots = NewCertPool()
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Error("verified without the root")
+	} else if _, ok := err.(UnknownAuthorityError); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	opts.Roots = nil
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Error("verified without a root pool")
+	}
+}
+
+func TestVerifyMixedChains(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name string
+		key  crypto.Signer
+		algo SignatureAlgorithm
+	}{
+		{"SM2", generateSM2Key(t), SM2WithSM3},
+		{"RSA", rsaKey, SHA256WithRSA},
+		{"ECDSA", ecKey, ECDSAWithSHA256},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// The root is created by crypto/x509 unless it is an SM2 root.
+			var root *Certificate
+			if test.algo == SM2WithSM3 {
+				root = issue(t, caTemplate(test.name+" Root"), nil, test.key.Public(), test.key)
+			} else {
+				template := &x509.Certificate{
+					SerialNumber:          big.NewInt(1),
+					Subject:               pkix.Name{CommonName: test.name + " Root"},
+					NotBefore:             verifyTime.Add(-24 * time.Hour),
+					NotAfter:              verifyTime.Add(24 * time.Hour),
+					KeyUsage:              KeyUsageCertSign,
+					BasicConstraintsValid: true,
+					IsCA:                  true,
+				}
+				der, err := x509.CreateCertificate(rand.Reader, template, template, test.key.Public(), test.key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if root, err = ParseCertificate(der); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if root.SignatureAlgorithm != test.algo {
+				t.Fatalf("root signature algorithm %v, want %v", root.SignatureAlgorithm, test.algo)
+			}
+
+			intermediateKey := generateSM2Key(t)
+			intermediate := issue(t, caTemplate("SM2 Intermediate"), root, intermediateKey.Public(), test.key)
+			if intermediate.SignatureAlgorithm != test.algo {
+				t.Errorf("intermediate signature algorithm %v, want %v", intermediate.SignatureAlgorithm, test.algo)
+			}
+			leafKey := generateSM2Key(t)
+			leaf := issue(t, leafTemplate("gm.example.com"), intermediate, leafKey.Public(), intermediateKey)
+
+			roots, intermediates := NewCertPool(), NewCertPool()
+			roots.AddCert(root)
+			intermediates.AddCert(intermediate)
+			chains, err := leaf.Verify(VerifyOptions{
+				DNSName:       "gm.example.com",
+				Roots:         roots,
+				Intermediates: intermediates,
+				CurrentTime:   verifyTime,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chains) != 1 || len(chains[0]) != 3 || !chains[0][1].Equal(intermediate) || !chains[0][2].Equal(root) {
+				t.Fatalf("unexpected chains %v", chains)
+			}
+
+			if _, err := leaf.Verify(VerifyOptions{Roots: roots, CurrentTime: verifyTime}); err == nil {
+				t.Error("verified without the intermediate")
+			}
+		})
+	}
+}
+
+func TestVerifyConstraints(t *testing.T) {
+	rootKey := generateSM2Key(t)
+	intermediateKey := generateSM2Key(t)
+	leafKey := generateSM2Key(t)
+
+	rootTemplate := caTemplate("Constrained Root")
+	rootTemplate.PermittedDNSDomains = []string{"example.com"}
+	rootTemplate.ExcludedIPRanges = []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}
+	root := issue(t, rootTemplate, nil, rootKey.Public(), rootKey)
+	roots := NewCertPool()
+	roots.AddCert(root)
+	opts := VerifyOptions{Roots: roots, CurrentTime: verifyTime}
+
+	leaf := issue(t, leafTemplate("a.example.com"), root, leafKey.Public(), rootKey)
+	if _, err := leaf.Verify(opts); err != nil {
+		t.Errorf("permitted name: %v", err)
+	}
+
+	for _, template := range []*Certificate{
+		leafTemplate("a.example.org"),
+		func() *Certificate {
+			template := leafTemplate("a.example.com")
+			template.IPAddresses = []net.IP{net.IPv4(10, 1, 2, 3)}
+			return template
+		}(),
+	} {
+		leaf := issue(t, template, root, leafKey.Public(), rootKey)
+		if _, err := leaf.Verify(opts); err == nil {
+			t.Errorf("verified %v %v despite name constraints", leaf.DNSNames, leaf.IPAddresses)
+		} else if e, ok := err.(CertificateInvalidError); !ok || e.Reason != CANotAuthorizedForThisName {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	// A root with a path length of zero cannot have intermediates.
+	rootTemplate = caTemplate("Path Length Root")
+	rootTemplate.MaxPathLenZero = true
+	root = issue(t, rootTemplate, nil, rootKey.Public(), rootKey)
+	intermediate := issue(t, caTemplate("Intermediate"), root, intermediateKey.Public(), rootKey)
+	leaf = issue(t, leafTemplate(), intermediate, leafKey.Public(), intermediateKey)
+	roots, intermediates := NewCertPool(), NewCertPool()
+	roots.AddCert(root)
+	intermediates.AddCert(intermediate)
+	opts = VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: verifyTime}
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Error("verified a chain longer than the path length constraint")
+	}
+
+	// An issuer that is not a CA, or whose key usage does not include
+	// certificate signing, is rejected.
+	root = issue(t, caTemplate("Root"), nil, rootKey.Public(), rootKey)
+	roots = NewCertPool()
+	roots.AddCert(root)
+	for _, template := range []*Certificate{
+		{Subject: pkix.Name{CommonName: "Not a CA"}, BasicConstraintsValid: true},
+		{Subject: pkix.Name{CommonName: "No CertSign"}, BasicConstraintsValid: true, IsCA: true, KeyUsage: KeyUsageDigitalSignature},
+	} {
+		intermediate := issue(t, template, root, intermediateKey.Public(), rootKey)
+		leaf := issue(t, leafTemplate(), intermediate, leafKey.Public(), intermediateKey)
+		intermediates := NewCertPool()
+		intermediates.AddCert(intermediate)
+		if _, err := leaf.Verify(VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: verifyTime}); err == nil {
+			t.Errorf("verified a certificate issued by %q", template.Subject.CommonName)
+		}
+	}
+
+	// An expired intermediate breaks the chain.
+	template := caTemplate("Expired Intermediate")
+	template.NotBefore = verifyTime.Add(-48 * time.Hour)
+	template.NotAfter = verifyTime.Add(-24 * time.Hour)
+	intermediate = issue(t, template, root, intermediateKey.Public(), rootKey)
+	leaf = issue(t, leafTemplate(), intermediate, leafKey.Public(), intermediateKey)
+	intermediates = NewCertPool()
+	intermediates.AddCert(intermediate)
+	if _, err := leaf.Verify(VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: verifyTime}); err == nil {
+		t.Error("verified a chain with an expired intermediate")
+	}
+}
+
+func TestCertPool(t *testing.T) {
+	pool := NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(opensslRootPEM + opensslLeafPEM + opensslCSRPEM)) {
+		t.Fatal("no certificates appended")
+	}
+	if len(pool.Subjects()) != 2 {
+		t.Errorf("pool has %d certificates, want 2", len(pool.Subjects()))
+	}
+	pool.AddCert(mustParseCertificate(t, opensslRootPEM))
+	if len(pool.Subjects()) != 2 {
+		t.Error("duplicate certificate added")
+	}
+	if pool.AppendCertsFromPEM([]byte(opensslCSRPEM)) {
+		t.Error("a CSR was appended as a certificate")
+	}
+}
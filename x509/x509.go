@@ -0,0 +1,462 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE-GO file.
+package x509
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+var (
+	// oidPublicKeyECDSA is id-ecPublicKey, used with the SM2 curve as its
+	// parameter by OpenSSL and GmSSL.
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	// oidSM2 identifies both the SM2 algorithm and the sm2p256v1 curve.
+	oidSM2 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+
+	oidPublicKeyRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPublicKeyEd25519 = oidSignatureEd25519
+)
+
+// PublicKeyAlgorithm identifies the algorithm of a public key.
+type PublicKeyAlgorithm int
+
+const (
+	UnknownPublicKeyAlgorithm PublicKeyAlgorithm = iota
+	RSA
+	ECDSA
+	Ed25519
+	SM2
+)
+
+var publicKeyAlgoName = [...]string{
+	RSA:     "RSA",
+	ECDSA:   "ECDSA",
+	Ed25519: "Ed25519",
+	SM2:     "SM2",
+}
+
+func (algo PublicKeyAlgorithm) String() string {
+	if 0 < algo && int(algo) < len(publicKeyAlgoName) {
+		return publicKeyAlgoName[algo]
+	}
+	return strconv.Itoa(int(algo))
+}
+
+func getPublicKeyAlgorithmFromOID(oid asn1.ObjectIdentifier) PublicKeyAlgorithm {
+	switch {
+	case oid.Equal(oidPublicKeyRSA):
+		return RSA
+	case oid.Equal(oidPublicKeyECDSA):
+		return ECDSA
+	case oid.Equal(oidPublicKeyEd25519):
+		return Ed25519
+	case oid.Equal(oidSM2):
+		return SM2
+	}
+	return UnknownPublicKeyAlgorithm
+}
+
+// SignatureAlgorithm identifies the algorithm of a signature. SM2WithSM3 is
+// computed with sm2.DefaultID, the other algorithms are those of
+// crypto/x509, accepted so that chains can mix SM2 and other keys.
+type SignatureAlgorithm int
+
+const (
+	UnknownSignatureAlgorithm SignatureAlgorithm = iota
+	SM2WithSM3
+	SHA1WithRSA
+	SHA256WithRSA
+	SHA384WithRSA
+	SHA512WithRSA
+	ECDSAWithSHA1
+	ECDSAWithSHA256
+	ECDSAWithSHA384
+	ECDSAWithSHA512
+	SHA256WithRSAPSS
+	SHA384WithRSAPSS
+	SHA512WithRSAPSS
+	PureEd25519
+)
+
+func (algo SignatureAlgorithm) isRSAPSS() bool {
+	switch algo {
+	case SHA256WithRSAPSS, SHA384WithRSAPSS, SHA512WithRSAPSS:
+		return true
+	default:
+		return false
+	}
+}
+
+func (algo SignatureAlgorithm) String() string {
+	for _, details := range signatureAlgorithmDetails {
+		if details.algo == algo {
+			return details.name
+		}
+	}
+	return strconv.Itoa(int(algo))
+}
+
+var (
+	oidSignatureSM2WithSM3      = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+	oidSignatureSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSignatureSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidSignatureRSAPSS          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidSignatureECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidMGF1 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+)
+
+var signatureAlgorithmDetails = []struct {
+	algo       SignatureAlgorithm
+	name       string
+	oid        asn1.ObjectIdentifier
+	pubKeyAlgo PublicKeyAlgorithm
+	hash       crypto.Hash
+}{
+	{SM2WithSM3, "SM2-SM3", oidSignatureSM2WithSM3, SM2, 0 /* SM3 is computed by sm2 */},
+	{SHA1WithRSA, "SHA1-RSA", oidSignatureSHA1WithRSA, RSA, crypto.SHA1},
+	{SHA256WithRSA, "SHA256-RSA", oidSignatureSHA256WithRSA, RSA, crypto.SHA256},
+	{SHA384WithRSA, "SHA384-RSA", oidSignatureSHA384WithRSA, RSA, crypto.SHA384},
+	{SHA512WithRSA, "SHA512-RSA", oidSignatureSHA512WithRSA, RSA, crypto.SHA512},
+	{SHA256WithRSAPSS, "SHA256-RSAPSS", oidSignatureRSAPSS, RSA, crypto.SHA256},
+	{SHA384WithRSAPSS, "SHA384-RSAPSS", oidSignatureRSAPSS, RSA, crypto.SHA384},
+	{SHA512WithRSAPSS, "SHA512-RSAPSS", oidSignatureRSAPSS, RSA, crypto.SHA512},
+	{ECDSAWithSHA1, "ECDSA-SHA1", oidSignatureECDSAWithSHA1, ECDSA, crypto.SHA1},
+	{ECDSAWithSHA256, "ECDSA-SHA256", oidSignatureECDSAWithSHA256, ECDSA, crypto.SHA256},
+	{ECDSAWithSHA384, "ECDSA-SHA384", oidSignatureECDSAWithSHA384, ECDSA, crypto.SHA384},
+	{ECDSAWithSHA512, "ECDSA-SHA512", oidSignatureECDSAWithSHA512, ECDSA, crypto.SHA512},
+	{PureEd25519, "Ed25519", oidSignatureEd25519, Ed25519, crypto.Hash(0) /* no pre-hashing */},
+}
+
+// pssParameters reflects the parameters in an AlgorithmIdentifier that
+// specifies RSA PSS. See RFC 3447, Appendix A.2.3.
+type pssParameters struct {
+	// The following three fields are not marked as
+	// optional because the default values specify SHA-1,
+	// which is no longer suitable for use in signatures.
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength   int                      `asn1:"explicit,tag:2"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+func getSignatureAlgorithmFromAI(ai pkix.AlgorithmIdentifier) SignatureAlgorithm {
+	if !ai.Algorithm.Equal(oidSignatureRSAPSS) {
+		for _, details := range signatureAlgorithmDetails {
+			if ai.Algorithm.Equal(details.oid) {
+				return details.algo
+			}
+		}
+		return UnknownSignatureAlgorithm
+	}
+
+	// RSA PSS is special because it encodes important parameters
+	// in the Parameters.
+	var params pssParameters
+	if _, err := asn1.Unmarshal(ai.Parameters.FullBytes, &params); err != nil {
+		return UnknownSignatureAlgorithm
+	}
+
+	var mgf1HashFunc pkix.AlgorithmIdentifier
+	if _, err := asn1.Unmarshal(params.MGF.Parameters.FullBytes, &mgf1HashFunc); err != nil {
+		return UnknownSignatureAlgorithm
+	}
+
+	// PSS is greatly overburdened with options. This code forces them into
+	// three buckets by requiring that the MGF1 hash function always match
+	// the message hash function (as recommended in RFC 3447, Section 8.1),
+	// that the salt length matches the hash length, and that the trailer
+	// field has the default value.
+	if (len(params.Hash.Parameters.FullBytes) != 0 && !bytesEqual(params.Hash.Parameters.FullBytes, asn1.NullBytes)) ||
+		!params.MGF.Algorithm.Equal(oidMGF1) ||
+		!mgf1HashFunc.Algorithm.Equal(params.Hash.Algorithm) ||
+		(len(mgf1HashFunc.Parameters.FullBytes) != 0 && !bytesEqual(mgf1HashFunc.Parameters.FullBytes, asn1.NullBytes)) ||
+		params.TrailerField != 1 {
+		return UnknownSignatureAlgorithm
+	}
+
+	switch {
+	case params.Hash.Algorithm.Equal(oidSHA256) && params.SaltLength == 32:
+		return SHA256WithRSAPSS
+	case params.Hash.Algorithm.Equal(oidSHA384) && params.SaltLength == 48:
+		return SHA384WithRSAPSS
+	case params.Hash.Algorithm.Equal(oidSHA512) && params.SaltLength == 64:
+		return SHA512WithRSAPSS
+	}
+
+	return UnknownSignatureAlgorithm
+}
+
+func bytesEqual(a, b []byte) bool {
+	return string(a) == string(b)
+}
+
+// ErrUnsupportedAlgorithm results from attempting to perform an operation
+// that involves algorithms that are not currently implemented.
+var ErrUnsupportedAlgorithm = errors.New("x509: cannot verify signature: algorithm unimplemented")
+
+// InsecureAlgorithmError results when the signature algorithm for a
+// certificate is known to be insecure.
+type InsecureAlgorithmError SignatureAlgorithm
+
+func (e InsecureAlgorithmError) Error() string {
+	return fmt.Sprintf("x509: cannot verify signature: insecure algorithm %v", SignatureAlgorithm(e))
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// checkSignature verifies that signature is a valid signature over signed
+// from a crypto.PublicKey. SM2 signatures are checked with sm2.DefaultID.
+func checkSignature(algo SignatureAlgorithm, signed, signature []byte, publicKey crypto.PublicKey) (err error) {
+	var hashType crypto.Hash
+	var pubKeyAlgo PublicKeyAlgorithm
+
+	for _, details := range signatureAlgorithmDetails {
+		if details.algo == algo {
+			hashType = details.hash
+			pubKeyAlgo = details.pubKeyAlgo
+		}
+	}
+
+	switch hashType {
+	case crypto.Hash(0):
+		if pubKeyAlgo != Ed25519 && pubKeyAlgo != SM2 {
+			return ErrUnsupportedAlgorithm
+		}
+	case crypto.SHA1:
+		return InsecureAlgorithmError(algo)
+	}
+
+	var digest []byte
+	if hashType != 0 {
+		h := hashType.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch pub := publicKey.(type) {
+	case *sm2.PublicKey:
+		if pubKeyAlgo != SM2 {
+			return signaturePublicKeyAlgoMismatchError(pubKeyAlgo, pub)
+		}
+		if !pub.VerifyASN1(signed, signature, &sm2.SignerOpts{}) {
+			return errors.New("x509: SM2 verification failure")
+		}
+		return
+	case *rsa.PublicKey:
+		if pubKeyAlgo != RSA {
+			return signaturePublicKeyAlgoMismatchError(pubKeyAlgo, pub)
+		}
+		if algo.isRSAPSS() {
+			return rsa.VerifyPSS(pub, hashType, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(pub, hashType, digest, signature)
+	case *ecdsa.PublicKey:
+		if pubKeyAlgo != ECDSA {
+			return signaturePublicKeyAlgoMismatchError(pubKeyAlgo, pub)
+		}
+		ecdsaSig := new(ecdsaSignature)
+		if rest, err := asn1.Unmarshal(signature, ecdsaSig); err != nil {
+			return err
+		} else if len(rest) != 0 {
+			return errors.New("x509: trailing data after ECDSA signature")
+		}
+		if ecdsaSig.R.Sign() <= 0 || ecdsaSig.S.Sign() <= 0 {
+			return errors.New("x509: ECDSA signature contained zero or negative values")
+		}
+		if !ecdsa.Verify(pub, digest, ecdsaSig.R, ecdsaSig.S) {
+			return errors.New("x509: ECDSA verification failure")
+		}
+		return
+	case ed25519.PublicKey:
+		if pubKeyAlgo != Ed25519 {
+			return signaturePublicKeyAlgoMismatchError(pubKeyAlgo, pub)
+		}
+		if !ed25519.Verify(pub, signed, signature) {
+			return errors.New("x509: Ed25519 verification failure")
+		}
+		return
+	}
+	return ErrUnsupportedAlgorithm
+}
+
+func signaturePublicKeyAlgoMismatchError(expectedPubKeyAlgo PublicKeyAlgorithm, pubKey interface{}) error {
+	return fmt.Errorf("x509: signature algorithm specifies an %s public key, but have public key of type %T", expectedPubKeyAlgo.String(), pubKey)
+}
+
+type publicKeyInfo struct {
+	Raw       asn1.RawContent
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ParsePKIXPublicKey parses an SM2 public key in PKIX, ASN.1 DER form. The
+// algorithm may be id-ecPublicKey with the sm2p256v1 curve or the SM2 OID,
+// and the point may be uncompressed, compressed or hybrid.
+//
+// This kind of key is commonly encoded in PEM blocks of type "PUBLIC KEY".
+func ParsePKIXPublicKey(derBytes []byte) (*sm2.PublicKey, error) {
+	var pki publicKeyInfo
+	if rest, err := asn1.Unmarshal(derBytes, &pki); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("x509: trailing data after ASN.1 of public-key")
+	}
+	return parseSM2PublicKey(&pki)
+}
+
+// isSM2PublicKey reports whether the algorithm of a SubjectPublicKeyInfo is
+// the SM2 OID, or id-ecPublicKey with the sm2p256v1 curve.
+func isSM2PublicKey(ai pkix.AlgorithmIdentifier) bool {
+	if ai.Algorithm.Equal(oidSM2) {
+		return true
+	}
+	if !ai.Algorithm.Equal(oidPublicKeyECDSA) {
+		return false
+	}
+	var namedCurveOID asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(ai.Parameters.FullBytes, &namedCurveOID)
+	return err == nil && len(rest) == 0 && namedCurveOID.Equal(oidSM2)
+}
+
+// parsePublicKey parses the public key of a certificate or a certificate
+// request. SM2 keys are returned as *sm2.PublicKey, RSA, ECDSA and Ed25519
+// keys as crypto/x509 does, and keys of other algorithms as nil.
+func parsePublicKey(keyData *publicKeyInfo) (crypto.PublicKey, PublicKeyAlgorithm, error) {
+	if isSM2PublicKey(keyData.Algorithm) {
+		pub, err := parseSM2PublicKey(keyData)
+		return pub, SM2, err
+	}
+
+	algo := getPublicKeyAlgorithmFromOID(keyData.Algorithm.Algorithm)
+	if algo == UnknownPublicKeyAlgorithm {
+		return nil, algo, nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(keyData.Raw)
+	if err != nil {
+		return nil, algo, err
+	}
+	return pub, algo, nil
+}
+
+func parseSM2PublicKey(keyData *publicKeyInfo) (*sm2.PublicKey, error) {
+	algo := keyData.Algorithm.Algorithm
+	if !algo.Equal(oidPublicKeyECDSA) && !algo.Equal(oidSM2) {
+		return nil, fmt.Errorf("x509: unknown public key algorithm %v", algo)
+	}
+
+	// The SM2 OID implies the curve, id-ecPublicKey must name it.
+	params := keyData.Algorithm.Parameters.FullBytes
+	if len(params) != 0 && !(len(params) == 2 && params[0] == asn1.TagNull) {
+		var namedCurveOID asn1.ObjectIdentifier
+		rest, err := asn1.Unmarshal(params, &namedCurveOID)
+		if err != nil || len(rest) != 0 {
+			return nil, errors.New("x509: failed to parse SM2 parameters as named curve")
+		}
+		if !namedCurveOID.Equal(oidSM2) {
+			return nil, errors.New("x509: unsupported elliptic curve")
+		}
+	} else if algo.Equal(oidPublicKeyECDSA) {
+		return nil, errors.New("x509: missing elliptic curve parameters")
+	}
+
+	pub, err := sm2.ParsePublicKey(keyData.PublicKey.RightAlign())
+	if err != nil {
+		return nil, errors.New("x509: failed to unmarshal elliptic curve point")
+	}
+	return pub, nil
+}
+
+// MarshalPKIXPublicKey converts an SM2 public key, a *sm2.PublicKey or an
+// *ecdsa.PublicKey on the SM2 curve, to PKIX, ASN.1 DER form with
+// id-ecPublicKey as the algorithm and an uncompressed point.
+//
+// This kind of key is commonly encoded in PEM blocks of type "PUBLIC KEY".
+func MarshalPKIXPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	publicKeyBytes, publicKeyAlgorithm, err := marshalPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(publicKeyInfo{
+		Algorithm: publicKeyAlgorithm,
+		PublicKey: asn1.BitString{
+			Bytes:     publicKeyBytes,
+			BitLength: 8 * len(publicKeyBytes),
+		},
+	})
+}
+
+func marshalPublicKey(pub crypto.PublicKey) (publicKeyBytes []byte, publicKeyAlgorithm pkix.AlgorithmIdentifier, err error) {
+	key, err := sm2PublicKey(pub)
+	if err != nil {
+		return nil, pkix.AlgorithmIdentifier{}, err
+	}
+	paramBytes, err := asn1.Marshal(oidSM2)
+	if err != nil {
+		return nil, pkix.AlgorithmIdentifier{}, err
+	}
+	publicKeyAlgorithm.Algorithm = oidPublicKeyECDSA
+	publicKeyAlgorithm.Parameters.FullBytes = paramBytes
+	return sm2.Marshal(key.X, key.Y), publicKeyAlgorithm, nil
+}
+
+// sm2PublicKey returns pub as an *ecdsa.PublicKey on the SM2 curve.
+func sm2PublicKey(pub crypto.PublicKey) (*ecdsa.PublicKey, error) {
+	var key *ecdsa.PublicKey
+	switch pub := pub.(type) {
+	case *sm2.PublicKey:
+		if pub != nil {
+			key = pub.PublicKey
+		}
+	case *ecdsa.PublicKey:
+		key = pub
+	default:
+		return nil, fmt.Errorf("x509: unsupported public key type: %T", pub)
+	}
+	if key == nil || key.Curve == nil || key.Params() != sm2.Curve().Params() {
+		return nil, errors.New("x509: only SM2 public keys are supported")
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("x509: invalid SM2 public key")
+	}
+	return key, nil
+}
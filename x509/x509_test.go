@@ -0,0 +1,89 @@
+// Copyright Jiangsu Rongzer Information Technology Co., Ltd. 2020 All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//                 http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package x509
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/rongzer/gm/sm2"
+)
+
+// The public key of opensslPKCS8PEM as written by "openssl pkey -pubout",
+// uncompressed and with "-conv_form compressed".
+const (
+	opensslPublicKeyPEM = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoEcz1UBgi0DQgAEtuoY/a//grom+gMm0mwT9OliR5yZ
+eP7p2d0JT8FitCIvj2F5abIeYM5+DIQV6zCi3ouDjDQsORi4KF5tUpG6uw==
+-----END PUBLIC KEY-----
+`
+	opensslCompressedPublicKeyPEM = `-----BEGIN PUBLIC KEY-----
+MDkwEwYHKoZIzj0CAQYIKoEcz1UBgi0DIgADtuoY/a//grom+gMm0mwT9OliR5yZ
+eP7p2d0JT8FitCI=
+-----END PUBLIC KEY-----
+`
+)
+
+func TestParsePKIXPublicKey(t *testing.T) {
+	key, _ := PEMToPrivateKey([]byte(opensslPKCS8PEM))
+	block, _ := pem.Decode([]byte(opensslPublicKeyPEM))
+
+	for _, data := range []string{opensslPublicKeyPEM, opensslCompressedPublicKeyPEM} {
+		b, _ := pem.Decode([]byte(data))
+		pub, err := ParsePKIXPublicKey(b.Bytes)
+		if err != nil {
+			t.Fatalf("failed to parse: %s", err)
+		}
+		if !pub.Equal(&key.PublicKey) {
+			t.Error("parsed a different public key")
+		}
+
+		der, err := MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatalf("failed to marshal: %s", err)
+		}
+		if !bytes.Equal(der, block.Bytes) {
+			t.Errorf("marshaled key is\n%x\nwant\n%x", der, block.Bytes)
+		}
+	}
+
+	// An *ecdsa.PublicKey on the SM2 curve is accepted as well.
+	der, err := MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil || !bytes.Equal(der, block.Bytes) {
+		t.Errorf("MarshalPKIXPublicKey(*ecdsa.PublicKey) = %x, %v", der, err)
+	}
+}
+
+func TestPKIXPublicKeyInvalid(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := MarshalPKIXPublicKey(&p256.PublicKey); err == nil {
+		t.Error("marshaled a P-256 key")
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&p256.PublicKey)
+	if _, err := ParsePKIXPublicKey(der); err == nil {
+		t.Error("parsed a P-256 key")
+	}
+
+	key, _ := sm2.GenerateKey()
+	der, _ = MarshalPKIXPublicKey(key.Public())
+	if _, err := ParsePKIXPublicKey(append(der, 0)); err == nil {
+		t.Error("parsed a key with trailing data")
+	}
+	der[len(der)-1] ^= 1
+	if _, err := ParsePKIXPublicKey(der); err == nil {
+		t.Error("parsed a point not on the curve")
+	}
+}